@@ -10,7 +10,6 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -21,6 +20,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -246,7 +246,12 @@ func (p *MessageProcessor) handleBotMessage(ctx context.Context, bot *tgbotapi.B
 				"   • /ss config - 查看 SS 配置\n"+
 				"   • /ss auto - 自动安装/重置 SS\n\n"+
 				"4️⃣ 查看状态\n"+
-				"   • 使用 /status 查看运行状态\n\n"+
+				"   • 使用 /status 查看运行状态\n"+
+				"   • /outbox - 查看提交失败待重试的发件箱\n"+
+				"   • /outbox flush - 立即重试  /outbox purge - 清空\n\n"+
+				"5️⃣ 离线回放\n"+
+				"   • 发送 tdl chat export 导出的 JSON，说明填写 /replay [频道ID]\n"+
+				"   • 按当前过滤规则演练提取结果，不提交、不转发\n\n"+
 				"💡 提示：文件名即为转发目标，发送JSON文件后会自动验证和清理无效消息！")
 		return
 	}
@@ -257,11 +262,69 @@ func (p *MessageProcessor) handleBotMessage(ctx context.Context, bot *tgbotapi.B
 			"📝 处理消息: %d\n"+
 			"🔄 转发次数: %d\n"+
 			"🎯 转发目标: %d",
-			p.messageCount, p.forwardCount, p.config.Bot.ForwardTarget)
+			atomic.LoadInt64(&p.messageCount), p.forwardCount, p.config.Bot.ForwardTarget)
+		if p.pipeline != nil {
+			pending, capacity := p.pipeline.Len()
+			status += fmt.Sprintf("\n📥 处理队列: %d/%d", pending, capacity)
+		}
+		if p.dryRun != nil {
+			status += fmt.Sprintf("\n🧪 演练模式: 已写入 %d 条决策记录", p.dryRun.Count())
+		}
+		if p.batcher != nil {
+			status += fmt.Sprintf("\n📦 节点批次待提交: %d", p.batcher.Pending())
+		}
+		if entries, _ := p.outbox.Len(); entries > 0 {
+			status += fmt.Sprintf("\n📮 发件箱待重试: %d", entries)
+		}
+		status += p.subRegistry.formatStatus()
+		status += p.formatChannelStats()
+		status += p.sinks.formatStats()
 		p.sendBotReply(bot, msg.Chat.ID, msg.MessageID, status)
 		return
 	}
 
+	// 处理 /outbox 命令
+	if strings.HasPrefix(text, "/outbox") {
+		parts := strings.Fields(text)
+		subCmd := ""
+		if len(parts) > 1 {
+			subCmd = parts[1]
+		}
+
+		switch subCmd {
+		case "":
+			p.sendBotReply(bot, msg.Chat.ID, msg.MessageID, p.formatOutboxStatus())
+		case "flush":
+			if entries, _ := p.outbox.Len(); entries == 0 {
+				p.sendBotReply(bot, msg.Chat.ID, msg.MessageID, "📮 发件箱为空")
+				return
+			}
+			p.sendBotReply(bot, msg.Chat.ID, msg.MessageID, "⏳ 正在重试发件箱...")
+			go func() {
+				sent, dropped, remaining, err := p.flushOutbox(ctx)
+				reply := fmt.Sprintf("📮 重试完成\n\n✅ 成功: %d\n🚫 被拒绝丢弃: %d\n📥 剩余: %d", sent, dropped, remaining)
+				if err != nil {
+					reply += fmt.Sprintf("\n\n⚠️ API 仍不可用: %v", err)
+				}
+				p.sendBotReply(bot, msg.Chat.ID, msg.MessageID, reply)
+			}()
+		case "purge":
+			purged := p.outbox.Purge()
+			p.releaseOutboxNodes(purged...)
+			n := len(purged)
+			fmt.Printf("📮 发件箱已清空 (userID=%d, 条目数=%d)\n", msg.From.ID, n)
+			p.sendBotReply(bot, msg.Chat.ID, msg.MessageID, fmt.Sprintf("🗑 已清空发件箱: %d 条", n))
+		default:
+			p.sendBotReply(bot, msg.Chat.ID, msg.MessageID,
+				"❌ 无效的子命令\n\n"+
+					"支持的命令:\n"+
+					"• /outbox - 查看发件箱\n"+
+					"• /outbox flush - 立即重试\n"+
+					"• /outbox purge - 清空发件箱")
+		}
+		return
+	}
+
 	// 处理 /ss 命令
 	if strings.HasPrefix(text, "/ss") {
 		parts := strings.Fields(text)
@@ -417,90 +480,29 @@ func (p *MessageProcessor) updateBotMessage(bot *tgbotapi.BotAPI, chatID int64,
 	bot.Send(edit)
 }
 
-// addNodesBatchToAPI 批量添加节点到 API
-func (p *MessageProcessor) addNodesBatchToAPI(nodes []string) (bool, *SubscriptionResponse) {
-	if !p.config.Monitor.Enabled || p.config.Monitor.SubscriptionAPI.AddURL == "" {
-		return false, nil
-	}
-
-	if len(nodes) == 0 {
-		return false, nil
-	}
-
-	apiURL := p.config.Monitor.SubscriptionAPI.AddURL
-
-	// 将多个节点用\n连接
-	batchSS := strings.Join(nodes, "\n")
-
-	reqBody := SubscriptionRequest{
-		SS:   batchSS,
-		Test: true,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		fmt.Printf("❌ JSON 序列化失败: %v\n", err)
-		return false, nil
-	}
-
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Printf("❌ 创建请求失败: %v\n", err)
-		return false, nil
-	}
-
-	req.Header.Set("X-API-Key", p.config.Monitor.SubscriptionAPI.ApiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	fmt.Printf("✅ 发送批量节点请求到 %s，共 %d 个节点\n", apiURL, len(nodes))
-
-	client := &http.Client{Timeout: 120 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("❌ 批量节点 API 请求失败: %v\n", err)
-		return false, nil
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("❌ 读取响应失败: %v\n", err)
+// addNodesBatchToAPI 批量添加节点到 API（200 和 409 视为成功）
+func (p *MessageProcessor) addNodesBatchToAPI(ctx context.Context, nodes []string) (bool, *SubscriptionResponse) {
+	if !p.config.Monitor.Enabled || !p.subAPI.Enabled() || len(nodes) == 0 {
 		return false, nil
 	}
 
-	// 记录原始响应（用于调试）
-	// fmt.Printf("[DEBUG] API 响应 (status=%d, body=%s)\n", resp.StatusCode, string(body))
-
-	var response SubscriptionResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		// fmt.Printf("[DEBUG] 解析响应失败 (error=%v, body=%s, status=%d)\n", err, string(body), resp.StatusCode)
-
-		// 如果是 200 状态码但解析失败，可能是纯文本响应
-		if resp.StatusCode == 200 {
-			return true, nil
-		}
-		return false, nil
-	}
-
-	if resp.StatusCode == 200 || resp.StatusCode == 409 {
-		// 记录日志
-		if response.TestedNodes != nil {
-			fmt.Printf("✅ 批量节点检测完成 (count=%d, tested=%d, duration=%s)\n", len(nodes), *response.TestedNodes, response.Duration)
+	fmt.Printf("✅ 发送批量节点请求，共 %d 个节点\n", len(nodes))
+	result, err := p.subAPI.SubmitNodes(ctx, nodes)
+	if !result.OK() {
+		if result.Tested() {
+			fmt.Printf("❌ 批量节点检测失败 (count=%d, %s)\n", len(nodes), result.Summary())
 		} else {
-			fmt.Printf("✅ 批量节点添加成功 (count=%d)\n", len(nodes))
+			fmt.Printf("❌ 批量节点提交失败 (尝试次数=%d): %v\n", result.Attempts, err)
 		}
-		return true, &response
+		return false, result.Response
 	}
 
-	// 处理检测失败的情况
-	if resp.StatusCode == 400 && response.TestedNodes != nil {
-		fmt.Printf("❌ 批量节点检测失败 (count=%d, tested=%d, duration=%s)\n", len(nodes), *response.TestedNodes, response.Duration)
-		return false, &response
+	if result.Tested() {
+		fmt.Printf("✅ 批量节点检测完成 (count=%d, %s)\n", len(nodes), result.Summary())
+	} else {
+		fmt.Printf("✅ 批量节点添加成功 (count=%d)\n", len(nodes))
 	}
-
-	// 其他错误
-	fmt.Printf("❌ 批量节点提交失败: %s\n", response.Error)
-	return false, &response
+	return true, result.Response
 }
 
 // handleSubscriptionLinks 处理多个订阅/节点链接
@@ -523,6 +525,21 @@ func (p *MessageProcessor) handleSubscriptionLinks(ctx context.Context, bot *tgb
 		}
 	}
 
+	// 校验节点链接并丢弃无效节点
+	nodes, _, rejected := validateNodeLinks(nodes)
+	for _, r := range rejected {
+		fmt.Printf("🚫 丢弃无效节点 (原因=%s): %.80s\n", r.Reason, r.Link)
+	}
+
+	// 按规范化指纹去除批次内的重复节点
+	nodes, duplicates := dedupeNodeLinks(nodes)
+	if duplicates > 0 {
+		fmt.Printf("♻️  跳过重复节点: %d 个\n", duplicates)
+	}
+
+	// 本地探测连通性，丢弃不可达的节点
+	nodes = p.probeNodes(ctx, nodes, 0, "")
+
 	// 合并结果统计
 	var allResponses []*SubscriptionResponse
 	var totalDurationSeconds float64
@@ -532,7 +549,11 @@ func (p *MessageProcessor) handleSubscriptionLinks(ctx context.Context, bot *tgb
 	// 处理订阅（逐个提交）
 	for _, subLink := range subscriptions {
 		fmt.Printf("✅ 检测到订阅: %s\n", subLink)
-		success, responseMsg := p.addSubscriptionToAPI(subLink, false)
+		if check, ok := p.precheckSubscription(ctx, subLink, 0); !ok {
+			errorMessages = append(errorMessages, fmt.Sprintf("订阅预检未通过 (%s): %s", check, subLink))
+			continue
+		}
+		success, responseMsg, result := p.addSubscriptionToAPI(ctx, subLink, false)
 
 		if success {
 			fmt.Printf("✅ 订阅添加成功: %s\n", subLink)
@@ -542,55 +563,17 @@ func (p *MessageProcessor) handleSubscriptionLinks(ctx context.Context, bot *tgb
 			errorMessages = append(errorMessages, responseMsg)
 		}
 
-		// 解析响应统计信息
-		if strings.Contains(responseMsg, "📊") {
-			var resp SubscriptionResponse
-			// 从消息中提取统计数据
-			lines := strings.Split(responseMsg, "\n")
-			for _, line := range lines {
-				if strings.Contains(line, "📊 检测:") {
-					var tested int
-					fmt.Sscanf(line, "📊 检测: %d个节点", &tested)
-					resp.TestedNodes = &tested
-				} else if strings.Contains(line, "✅ 通过:") {
-					var passed int
-					fmt.Sscanf(line, "✅ 通过: %d个", &passed)
-					resp.PassedNodes = &passed
-				} else if strings.Contains(line, "❌ 失败:") {
-					var failed int
-					fmt.Sscanf(line, "❌ 失败: %d个", &failed)
-					resp.FailedNodes = &failed
-				} else if strings.Contains(line, "➕ 添加:") {
-					var added int
-					fmt.Sscanf(line, "➕ 添加: %d个", &added)
-					resp.AddedNodes = &added
-				} else if strings.Contains(line, "⏱") {
-					idx := strings.Index(line, ":")
-					if idx > 0 {
-						resp.Duration = strings.TrimSpace(line[idx+1:])
-						// 解析耗时（假设格式为 "1.23s" 或 "123ms"）
-						if strings.HasSuffix(resp.Duration, "s") {
-							var sec float64
-							fmt.Sscanf(resp.Duration, "%fs", &sec)
-							totalDurationSeconds += sec
-						} else if strings.HasSuffix(resp.Duration, "ms") {
-							var ms float64
-							fmt.Sscanf(resp.Duration, "%fms", &ms)
-							totalDurationSeconds += ms / 1000
-						}
-					}
-				}
-			}
-			if resp.TestedNodes != nil {
-				allResponses = append(allResponses, &resp)
-			}
+		// 汇总检测统计信息
+		if result != nil && result.Tested() {
+			allResponses = append(allResponses, result.Response)
+			totalDurationSeconds += parseAPIDuration(result.Response.Duration)
 		}
 	}
 
 	// 处理节点（批量提交）
 	if len(nodes) > 0 {
 		fmt.Printf("✅ 检测到%d个节点，准备批量提交\n", len(nodes))
-		success, resp := p.addNodesBatchToAPI(nodes)
+		success, resp := p.addNodesBatchToAPI(ctx, nodes)
 
 		if success {
 			fmt.Printf("✅ 批量节点添加成功: %d个\n", len(nodes))
@@ -600,18 +583,7 @@ func (p *MessageProcessor) handleSubscriptionLinks(ctx context.Context, bot *tgb
 
 		if resp != nil && resp.TestedNodes != nil {
 			allResponses = append(allResponses, resp)
-			// 解析耗时
-			if resp.Duration != "" {
-				if strings.HasSuffix(resp.Duration, "s") {
-					var sec float64
-					fmt.Sscanf(resp.Duration, "%fs", &sec)
-					totalDurationSeconds += sec
-				} else if strings.HasSuffix(resp.Duration, "ms") {
-					var ms float64
-					fmt.Sscanf(resp.Duration, "%fms", &ms)
-					totalDurationSeconds += ms / 1000
-				}
-			}
+			totalDurationSeconds += parseAPIDuration(resp.Duration)
 		}
 	}
 
@@ -670,6 +642,14 @@ func (p *MessageProcessor) handleSubscriptionLinks(ctx context.Context, bot *tgb
 	p.updateBotMessage(bot, statusMsg.Chat.ID, statusMsg.MessageID, finalMsg)
 }
 
+// parseAPIDuration 解析 API 返回的耗时（如 "1.23s" 或 "123ms"），返回秒数
+func parseAPIDuration(duration string) float64 {
+	if d, err := time.ParseDuration(duration); err == nil {
+		return d.Seconds()
+	}
+	return 0
+}
+
 // extractTelegramLinks 提取 Telegram 链接
 func extractTelegramLinks(text string) []string {
 	var links []string
@@ -696,219 +676,54 @@ func extractTelegramLinks(text string) []string {
 	return links
 }
 
-// SubscriptionRequest 订阅或节点请求结构
-type SubscriptionRequest struct {
-	SubURL string `json:"sub_url,omitempty"`
-	SS     string `json:"ss,omitempty"`
-	Test   bool   `json:"test"`
-}
-
-// addSubscriptionToAPI 添加订阅或节点到 API
-func (p *MessageProcessor) addSubscriptionToAPI(link string, isNode bool) (bool, string) {
-	if !p.config.Monitor.Enabled || p.config.Monitor.SubscriptionAPI.AddURL == "" {
-		return false, "❌ 订阅 API 未配置"
+// addSubscriptionToAPI 添加订阅或节点到 API，返回 (是否成功, 回复文本, 提交结果)
+func (p *MessageProcessor) addSubscriptionToAPI(ctx context.Context, link string, isNode bool) (bool, string, *SubmitResult) {
+	if !p.config.Monitor.Enabled || !p.subAPI.Enabled() {
+		return false, "❌ 订阅 API 未配置", nil
 	}
 
-	apiURL := p.config.Monitor.SubscriptionAPI.AddURL
-
-	var reqBody SubscriptionRequest
-	if isNode {
-		reqBody.SS = link
-	} else {
-		reqBody.SubURL = link
-	}
-	reqBody.Test = true
-
 	linkType := "订阅"
 	if isNode {
 		linkType = "节点"
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		fmt.Printf("❌ JSON 序列化失败: %v\n", err)
-		return false, fmt.Sprintf("❌ 请求失败: %v", err)
-	}
-
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Printf("❌ 创建请求失败: %v\n", err)
-		return false, fmt.Sprintf("❌ 请求失败: %v", err)
-	}
-
-	req.Header.Set("X-API-Key", p.config.Monitor.SubscriptionAPI.ApiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	// fmt.Printf("[DEBUG] 发送%s请求到 %s\n", linkType, apiURL)
+	result, err := p.subAPI.SubmitLink(ctx, link, isNode)
 
-	client := &http.Client{Timeout: 120 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("❌ %s API 请求失败: %v\n", linkType, err)
-		return false, "❌ 无法连接到服务器"
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("❌ 读取响应失败: %v\n", err)
-		return false, "❌ 读取响应失败"
-	}
-
-	// 记录原始响应（用于调试）
-	// fmt.Printf("[DEBUG] API 响应 (status=%d, body=%s)\n", resp.StatusCode, string(body))
-
-	var response SubscriptionResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		// fmt.Printf("[DEBUG] 解析响应失败 (error=%v, body=%s, status=%d)\n", err, string(body), resp.StatusCode)
-
-		// 如果是 200 状态码但解析失败，可能是纯文本响应
-		if resp.StatusCode == 200 {
-			return true, fmt.Sprintf("✅ %s添加成功", linkType)
-		}
-		return false, fmt.Sprintf("❌ %s添加失败 (状态码: %d)", linkType, resp.StatusCode)
-	}
-
-	if resp.StatusCode == 200 {
-		// 检查是否为检测模式响应
-		if response.TestedNodes != nil {
-			// 检测模式响应 - 判断是否有节点被添加
-			var msg string
-			var success bool
-			
-			// 判断是否有节点被成功添加
-			if response.AddedNodes != nil && *response.AddedNodes > 0 {
-				// 成功情况：有节点被添加
-				success = true
-				if isNode {
-					msg = "✅ 节点检测并添加成功\n"
-				} else {
-					msg = "✅ 订阅检测并添加成功\n"
-				}
-			} else {
-				// 失败情况：没有节点被添加
-				success = false
-				// 使用 API 返回的错误信息，如果没有则使用默认消息
-				if response.Error != "" {
-					msg = fmt.Sprintf("❌ %s\n", response.Error)
-				} else if isNode {
-					msg = "❌ 节点检测失败，未添加任何节点\n"
-				} else {
-					msg = "❌ 订阅检测失败，未添加任何节点\n"
-				}
-			}
-			
-			// 添加统计信息（成功和失败都显示）
-			msg += fmt.Sprintf("📊 检测: %d个节点\n", *response.TestedNodes)
-			if response.PassedNodes != nil {
-				msg += fmt.Sprintf("✅ 通过: %d个\n", *response.PassedNodes)
-			}
-			if response.FailedNodes != nil {
-				msg += fmt.Sprintf("❌ 失败: %d个\n", *response.FailedNodes)
-			}
-			if response.AddedNodes != nil {
-				msg += fmt.Sprintf("➕ 添加: %d个\n", *response.AddedNodes)
-			}
-			if response.Duration != "" {
-				msg += fmt.Sprintf("⏱ 耗时: %s", response.Duration)
-			}
-			if response.Timeout != nil && *response.Timeout && response.Warning != "" {
-				msg += "\n⚠️ " + response.Warning
-			}
-			
-			// 记录日志
-			if success {
-				fmt.Printf("✅ %s检测并添加成功 (link=%s, tested=%d, duration=%s)\n", linkType, link, *response.TestedNodes, response.Duration)
-			} else {
-				fmt.Printf("⚠️  %s检测失败，未添加节点 (link=%s, tested=%d, duration=%s)\n", linkType, link, *response.TestedNodes, response.Duration)
-			}
-			
-			return success, msg
-		} else {
-			// 普通模式响应
-			successMsg := response.Message
-			if successMsg == "" {
-				successMsg = fmt.Sprintf("%s添加成功", linkType)
-			}
-			fmt.Printf("✅ %s添加成功: %s - %s\n", linkType, link, successMsg)
-			return true, fmt.Sprintf("✅ %s", successMsg)
-		}
-	}
-
-	// 处理检测失败的情况（400状态码但包含检测统计信息）
-	if resp.StatusCode == 400 && response.TestedNodes != nil {
-		// 检测模式响应 - 检测失败
+	// 检测模式响应（200 或 400）- 判断是否有节点被添加
+	if result.Tested() && (err == nil || result.StatusCode == http.StatusBadRequest) {
 		var msg string
-		// 使用 API 返回的错误信息，如果没有则使用默认消息
-		if response.Error != "" {
-			msg = fmt.Sprintf("❌ %s\n", response.Error)
-		} else if isNode {
-			msg = "❌ 节点检测失败，未添加任何节点\n"
+		success := err == nil && result.Added() > 0
+		if success {
+			msg = fmt.Sprintf("✅ %s检测并添加成功\n", linkType)
+			fmt.Printf("✅ %s检测并添加成功 (link=%s, %s)\n", linkType, link, result.Summary())
 		} else {
-			msg = "❌ 订阅检测失败，未添加任何节点\n"
-		}
-		
-		// 添加统计信息
-		msg += fmt.Sprintf("📊 检测: %d个节点\n", *response.TestedNodes)
-		if response.PassedNodes != nil {
-			msg += fmt.Sprintf("✅ 通过: %d个\n", *response.PassedNodes)
-		}
-		if response.FailedNodes != nil {
-			msg += fmt.Sprintf("❌ 失败: %d个\n", *response.FailedNodes)
-		}
-		if response.AddedNodes != nil {
-			msg += fmt.Sprintf("➕ 添加: %d个\n", *response.AddedNodes)
+			// 使用 API 返回的错误信息，如果没有则使用默认消息
+			msg = fmt.Sprintf("❌ %s\n", result.ErrorText(linkType+"检测失败，未添加任何节点"))
+			fmt.Printf("⚠️  %s检测失败，未添加节点 (link=%s, %s)\n", linkType, link, result.Summary())
 		}
-		if response.Duration != "" {
-			msg += fmt.Sprintf("⏱️ 耗时: %s", response.Duration)
-		}
-		if response.Timeout != nil && *response.Timeout && response.Warning != "" {
-			msg += "\n⚠️ " + response.Warning
-		}
-		
-		fmt.Printf("⚠️  %s检测失败，未添加节点 (link=%s, tested=%d, duration=%s)\n", linkType, link, *response.TestedNodes, response.Duration)
-		
-		return false, msg
+		return success, msg + result.StatsText(), result
 	}
 
-	// 处理重复订阅或节点（409 Conflict）
-	if resp.StatusCode == 409 || resp.StatusCode == http.StatusConflict {
-		errorMsg := response.Error
-		if errorMsg == "" {
-			if isNode {
-				errorMsg = "节点已存在"
-			} else {
-				errorMsg = "该订阅链接已存在"
-			}
+	switch {
+	case result.OK() && result.Status == SubmitExists:
+		// 重复订阅或节点（409 Conflict），与监听路径一致视为成功
+		existsMsg := "该订阅链接已存在"
+		if isNode {
+			existsMsg = "节点已存在"
 		}
 		// fmt.Printf("[DEBUG] %s已存在 (link=%s)\n", linkType, link)
-		return false, fmt.Sprintf("⚠️ %s", errorMsg)
+		return true, fmt.Sprintf("⚠️ %s", existsMsg), result
+	case result.OK():
+		// 普通模式响应
+		fmt.Printf("✅ %s添加成功: %s\n", linkType, link)
+		return true, fmt.Sprintf("✅ %s添加成功", linkType), result
+	case result.StatusCode == 0:
+		fmt.Printf("❌ %s API 请求失败 (尝试次数=%d): %v\n", linkType, result.Attempts, err)
+		return false, "❌ 无法连接到服务器", result
+	default:
+		fmt.Printf("❌ %s添加失败 (link=%s, status=%d): %v\n", linkType, link, result.StatusCode, err)
+		return false, fmt.Sprintf("❌ %v", err), result
 	}
-
-	// 处理服务器错误（500+）
-	if resp.StatusCode >= 500 {
-		errorMsg := response.Error
-		if errorMsg == "" {
-			errorMsg = response.Message
-		}
-		if errorMsg == "" {
-			errorMsg = fmt.Sprintf("服务器错误 (状态码: %d)", resp.StatusCode)
-		}
-		fmt.Printf("❌ %s服务器错误 (link=%s, status=%d, error=%s)\n", linkType, link, resp.StatusCode, errorMsg)
-		return false, fmt.Sprintf("❌ %s", errorMsg)
-	}
-
-	// 其他错误
-	errorMsg := response.Error
-	if errorMsg == "" {
-		errorMsg = response.Message
-	}
-	if errorMsg == "" {
-		errorMsg = fmt.Sprintf("%s添加失败 (状态码: %d)", linkType, resp.StatusCode)
-	}
-
-	// fmt.Printf("[DEBUG] %s添加失败: %s\n", linkType, errorMsg)
-	return false, fmt.Sprintf("❌ %s", errorMsg)
 }
 
 // sendBotMessageWithKeyboard 发送带按钮的消息
@@ -1660,6 +1475,12 @@ func (p *MessageProcessor) executeSSCommand(ctx context.Context, subCmd string)
 // handleDocumentMessage 处理文档文件消息
 func (p *MessageProcessor) handleDocumentMessage(ctx context.Context, bot *tgbotapi.BotAPI, taskManager *TaskManager, msg *tgbotapi.Message) {
 	doc := msg.Document
+
+	// 说明为 /replay 的导出文件：离线回放监听流水线，不转发
+	if strings.HasPrefix(msg.Caption, "/replay") && strings.HasSuffix(doc.FileName, ".json") {
+		p.handleReplayDocument(ctx, bot, msg)
+		return
+	}
 	
 	// 检查文件类型
 	if !strings.HasSuffix(doc.FileName, ".json") {
@@ -0,0 +1,88 @@
+// tdl-msgproce - base64 节点包解码
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/gotd/td/tg"
+)
+
+// base64RunRegex 匹配正文中较长的 base64 / base64url 片段（短片段误判率高，不处理）
+var base64RunRegex = regexp.MustCompile(`[A-Za-z0-9+/_-]{40,}={0,2}`)
+
+// decodeMessageBundles 解码消息正文和代码实体中的 base64 节点包，返回解码后的文本（每个包一段）
+// 已被识别为链接的部分先从正文中剔除，避免把 vmess:// 等链接自身的 base64 负载当作节点包
+func (p *MessageProcessor) decodeMessageBundles(msg *tg.Message) string {
+	var candidates []string
+
+	plain := p.linkRegex.ReplaceAllString(msg.Message, " ")
+	candidates = append(candidates, base64RunRegex.FindAllString(plain, -1)...)
+
+	// 代码块中的 base64 常被自动换行，去除空白后整体解码
+	for _, code := range codeEntityTexts(msg) {
+		compact := strings.Join(strings.Fields(code), "")
+		if len(compact) >= 40 && base64RunRegex.FindString(compact) == compact {
+			candidates = append(candidates, compact)
+		}
+	}
+
+	var decoded []string
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		if text, ok := decodeBase64Bundle(candidate); ok {
+			decoded = append(decoded, text)
+		}
+	}
+	return strings.Join(decoded, "\n")
+}
+
+// decodeBase64Bundle 尝试以标准 / URL 安全、带或不带填充的 base64 解码
+// 只有解码结果是合法 UTF-8 文本且包含 "://" 时才视为节点包
+func decodeBase64Bundle(s string) (string, bool) {
+	data, err := decodeBase64Loose(s)
+	if err != nil || !utf8.Valid(data) || !strings.Contains(string(data), "://") {
+		return "", false
+	}
+	return string(data), true
+}
+
+// codeEntityTexts 提取消息中行内代码和代码块实体的文本（实体偏移量以 UTF-16 码元计）
+func codeEntityTexts(msg *tg.Message) []string {
+	entities, ok := msg.GetEntities()
+	if !ok {
+		return nil
+	}
+
+	var encoded []uint16
+	var texts []string
+	for _, entity := range entities {
+		switch entity.(type) {
+		case *tg.MessageEntityCode, *tg.MessageEntityPre:
+		default:
+			continue
+		}
+
+		if encoded == nil {
+			encoded = utf16.Encode([]rune(msg.Message))
+		}
+		start := entity.GetOffset()
+		end := start + entity.GetLength()
+		if start < 0 || end > len(encoded) || start >= end {
+			continue
+		}
+		texts = append(texts, string(utf16.Decode(encoded[start:end])))
+	}
+	return texts
+}
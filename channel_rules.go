@@ -0,0 +1,183 @@
+// tdl-msgproce - 频道级过滤与路由规则
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultSink = "api" // 默认输出：订阅 API
+
+// ChannelEntry channels 列表中的单个条目
+// 可以直接写频道引用（数字ID / @username / 链接），也可以写成带覆盖规则的对象：
+//
+//   - channel: "@example"
+//     content_filter: ["订阅"]
+//     link_blacklist: ["example.com"]
+//     protocols: ["vmess", "trojan"]
+//     sinks: [api, archive]
+type ChannelEntry struct {
+	Ref           string       `yaml:"channel"`        // 频道引用
+	ContentFilter []string     `yaml:"content_filter"` // 替换全局二次内容过滤关键词
+	LinkBlacklist []string     `yaml:"link_blacklist"` // 追加到全局链接黑名单
+	Protocols     []string     `yaml:"protocols"`      // 仅接受这些协议的链接（留空继承全局 subs/ss）
+	Sink          string       `yaml:"sink"`           // 单个输出目标（与 sinks 合并）
+	Sinks         []string     `yaml:"sinks"`          // 输出目标名称列表（留空发送到全部已启用的输出）
+	Rules         []FilterRule `yaml:"rules"`          // 追加的表达式规则
+}
+
+// UnmarshalYAML 支持标量（仅频道引用）和对象两种写法
+func (e *ChannelEntry) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		e.Ref = value.Value
+		return nil
+	}
+
+	type plain ChannelEntry
+	if err := value.Decode((*plain)(e)); err != nil {
+		return err
+	}
+	if e.Ref == "" {
+		return fmt.Errorf("第 %d 行: 频道条目缺少 channel 字段", value.Line)
+	}
+	return nil
+}
+
+// HasOverrides 是否配置了任何覆盖规则
+func (e *ChannelEntry) HasOverrides() bool {
+	return len(e.ContentFilter) > 0 || len(e.LinkBlacklist) > 0 || len(e.Protocols) > 0 || e.Sink != "" || len(e.Sinks) > 0 || len(e.Rules) > 0
+}
+
+// ChannelRules 频道生效的规则集（全局配置与频道覆盖合并后的结果）
+type ChannelRules struct {
+	Subs          []string
+	SS            []string
+	ContentFilter []string
+	LinkBlacklist []string
+	Protocols     []string
+	Rules         []FilterRule
+	Sinks         []string // 输出目标名称（为空表示全部已启用的输出）
+	Whitelisted   bool     // 白名单频道跳过二次内容过滤
+	Overridden    bool     // 是否有频道级覆盖
+
+	patterns patternSet // 预编译的正则关键词（来自配置）
+}
+
+// channelRules 返回频道生效的规则集，没有覆盖的频道继承全局设置
+func (p *MessageProcessor) channelRules(channelID int64) ChannelRules {
+	filters := p.config.Monitor.Filters
+	rules := ChannelRules{
+		Subs:          filters.Subs,
+		SS:            filters.SS,
+		ContentFilter: filters.ContentFilter,
+		LinkBlacklist: filters.LinkBlacklist,
+		Rules:         filters.Rules,
+		Whitelisted:   contains(p.config.Monitor.WhitelistChannels, channelID),
+		patterns:      p.config.patterns,
+	}
+
+	entry, ok := p.config.Monitor.ChannelOverrides[channelID]
+	if !ok {
+		return rules
+	}
+
+	rules.Overridden = true
+	if len(entry.ContentFilter) > 0 {
+		rules.ContentFilter = entry.ContentFilter
+	}
+	if len(entry.LinkBlacklist) > 0 {
+		rules.LinkBlacklist = append(append([]string{}, filters.LinkBlacklist...), entry.LinkBlacklist...)
+	}
+	if len(entry.Protocols) > 0 {
+		rules.Protocols = entry.Protocols
+		rules.Subs = filterProtocolPrefixes(filters.Subs, entry.Protocols)
+		rules.SS = filterProtocolPrefixes(filters.SS, entry.Protocols)
+	}
+	if len(entry.Rules) > 0 {
+		rules.Rules = append(append([]FilterRule{}, filters.Rules...), entry.Rules...)
+	}
+	if entry.Sink != "" {
+		rules.Sinks = append(rules.Sinks, entry.Sink)
+	}
+	rules.Sinks = append(rules.Sinks, entry.Sinks...)
+	return rules
+}
+
+// matchFormat 检查文本是否包含指定格式；频道限制了协议且过滤后为空时视为不匹配
+// （未限制协议时保持 matchAny 的行为：空列表匹配全部；协议前缀不含正则）
+func (r ChannelRules) matchFormat(text string, prefixes []string) bool {
+	if len(r.Protocols) > 0 && len(prefixes) == 0 {
+		return false
+	}
+	return r.patterns.matchAny(text, prefixes)
+}
+
+// HasSubsFormat 文本是否包含频道允许的订阅格式
+func (r ChannelRules) HasSubsFormat(text string) bool {
+	return r.matchFormat(text, r.Subs)
+}
+
+// HasNodeFormat 文本是否包含频道允许的节点格式
+func (r ChannelRules) HasNodeFormat(text string) bool {
+	return r.matchFormat(text, r.SS)
+}
+
+// AllowsLink 链接协议是否在频道允许的协议列表内（未限制协议时全部允许）
+func (r ChannelRules) AllowsLink(link string) bool {
+	return protocolAllowed(link, r.Protocols)
+}
+
+// protocolAllowed 链接协议是否在列表内（列表为空时全部允许）
+func protocolAllowed(link string, protocols []string) bool {
+	if len(protocols) == 0 {
+		return true
+	}
+	return len(filterProtocolPrefixes([]string{strings.SplitN(link, "://", 2)[0]}, protocols)) > 0
+}
+
+// Summary 规则集摘要（用于跳过消息时的日志）
+func (r ChannelRules) Summary() string {
+	source := "全局"
+	if r.Overridden {
+		source = "频道覆盖"
+	}
+	protocols := "全部"
+	if len(r.Protocols) > 0 {
+		protocols = strings.Join(r.Protocols, "/")
+	}
+	sinks := "全部"
+	if len(r.Sinks) > 0 {
+		sinks = strings.Join(r.Sinks, "/")
+	}
+	return fmt.Sprintf("%s: subs=%d项, ss=%d项, 内容过滤=[%s], 黑名单=%d项, 表达式规则=%d条, 协议=%s, 输出=%s, 白名单=%v",
+		source, len(r.Subs), len(r.SS), strings.Join(r.ContentFilter, ","), len(r.LinkBlacklist), len(r.Rules), protocols, sinks, r.Whitelisted)
+}
+
+// filterProtocolPrefixes 保留协议在 allowed 列表中的前缀（忽略大小写和 :// 后缀）
+func filterProtocolPrefixes(prefixes []string, allowed []string) []string {
+	var result []string
+	for _, prefix := range prefixes {
+		protocol := strings.ToLower(strings.TrimSuffix(prefix, "://"))
+		if alias, ok := protocolAliases[protocol]; ok {
+			protocol = alias
+		}
+		for _, a := range allowed {
+			allowedProtocol := strings.ToLower(strings.TrimSuffix(a, "://"))
+			if alias, ok := protocolAliases[allowedProtocol]; ok {
+				allowedProtocol = alias
+			}
+			if protocol == allowedProtocol {
+				result = append(result, prefix)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,340 @@
+// tdl-msgproce - 频道同步状态（pts / 最后处理消息ID）追踪与断线补偿
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	channelDifferenceLimit = 100             // 单次 getChannelDifference 获取的最大消息数
+	channelCatchUpMaxLoops = 50              // 单次补偿最多循环次数，防止无限拉取
+	channelCatchUpInterval = 5 * time.Minute // 定期补偿间隔（覆盖静默断线重连的情况）
+)
+
+// persistedChannelState 持久化到磁盘的频道同步状态
+type persistedChannelState struct {
+	Pts           map[int64]int `json:"pts"`             // 频道ID -> pts
+	LastMessageID map[int64]int `json:"last_message_id"` // 频道ID -> 最后处理的消息ID（历史消息高水位）
+}
+
+// loadChannelState 从磁盘加载频道同步状态
+func (p *MessageProcessor) loadChannelState(filename string) error {
+	p.channelPtsMu.Lock()
+	p.channelStatePath = filename
+	p.channelPtsMu.Unlock()
+
+	var state persistedChannelState
+	found, err := loadJSONFile(filename, &state)
+	if err != nil || !found {
+		return err
+	}
+
+	p.channelPtsMu.Lock()
+	defer p.channelPtsMu.Unlock()
+	for channelID, pts := range state.Pts {
+		p.channelPts[channelID] = pts
+	}
+	for channelID, msgID := range state.LastMessageID {
+		p.channelLastMsgID[channelID] = msgID
+		// 记录启动时的高水位快照，避免启动期间的实时消息推进高水位后导致历史续取漏掉中间的消息
+		p.historyResumeIDs[channelID] = msgID
+	}
+	return nil
+}
+
+// saveChannelState 将频道同步状态写入磁盘，无变更时跳过
+func (p *MessageProcessor) saveChannelState() error {
+	p.channelPtsMu.Lock()
+	if !p.channelStateDirty || p.channelStatePath == "" {
+		p.channelPtsMu.Unlock()
+		return nil
+	}
+	state := persistedChannelState{
+		Pts:           make(map[int64]int, len(p.channelPts)),
+		LastMessageID: make(map[int64]int, len(p.channelLastMsgID)),
+	}
+	for channelID, pts := range p.channelPts {
+		state.Pts[channelID] = pts
+	}
+	for channelID, msgID := range p.channelLastMsgID {
+		state.LastMessageID[channelID] = msgID
+	}
+	filename := p.channelStatePath
+	p.channelStateDirty = false
+	p.channelPtsMu.Unlock()
+
+	if err := saveJSONFile(filename, state); err != nil {
+		p.channelPtsMu.Lock()
+		p.channelStateDirty = true
+		p.channelPtsMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// StartChannelStateAutoSave 定期将频道同步状态写入磁盘，ctx 结束时执行最后一次保存
+func (p *MessageProcessor) StartChannelStateAutoSave(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := p.saveChannelState(); err != nil {
+				fmt.Printf("⚠️  保存频道同步状态失败: %v\n", err)
+			}
+			return
+		case <-ticker.C:
+			if err := p.saveChannelState(); err != nil {
+				fmt.Printf("⚠️  保存频道同步状态失败: %v\n", err)
+			}
+		}
+	}
+}
+
+// monitoredChannels 返回监听列表中的频道（含超级群组）ID
+// 普通群组和私聊没有独立的 pts，不参与差异补偿和历史消息获取
+func (p *MessageProcessor) monitoredChannels() []int64 {
+	var channels []int64
+	for _, id := range p.config.Monitor.Channels {
+		if kind, ok := p.config.Monitor.PeerKinds[id]; !ok || kind == peerKindChannel {
+			channels = append(channels, id)
+		}
+	}
+	return channels
+}
+
+// getChannelPts 获取频道已记录的 pts，0 表示未知
+func (p *MessageProcessor) getChannelPts(channelID int64) int {
+	p.channelPtsMu.RLock()
+	defer p.channelPtsMu.RUnlock()
+	return p.channelPts[channelID]
+}
+
+// setChannelPts 记录频道 pts（只前进不后退）
+func (p *MessageProcessor) setChannelPts(channelID int64, pts int) {
+	p.channelPtsMu.Lock()
+	defer p.channelPtsMu.Unlock()
+	if pts > p.channelPts[channelID] {
+		p.channelPts[channelID] = pts
+		p.channelStateDirty = true
+	}
+}
+
+// getChannelLastMessageID 获取频道最后处理的消息ID，0 表示首次见到该频道
+func (p *MessageProcessor) getChannelLastMessageID(channelID int64) int {
+	p.channelPtsMu.RLock()
+	defer p.channelPtsMu.RUnlock()
+	return p.channelLastMsgID[channelID]
+}
+
+// setChannelLastMessageID 记录频道最后处理的消息ID（只记录监听频道，只前进不后退）
+func (p *MessageProcessor) setChannelLastMessageID(channelID int64, messageID int) {
+	if !contains(p.monitoredChannels(), channelID) {
+		return
+	}
+
+	p.channelPtsMu.Lock()
+	defer p.channelPtsMu.Unlock()
+	if messageID > p.channelLastMsgID[channelID] {
+		p.channelLastMsgID[channelID] = messageID
+		p.channelStateDirty = true
+	}
+}
+
+// trackChannelPts 根据实时更新推进频道 pts，返回是否检测到缺口
+// 检测到缺口时不推进 pts，由补偿流程从旧 pts 开始拉取差异
+func (p *MessageProcessor) trackChannelPts(channelID int64, pts int, ptsCount int) bool {
+	if !contains(p.config.Monitor.Channels, channelID) {
+		return false
+	}
+
+	p.channelPtsMu.Lock()
+	defer p.channelPtsMu.Unlock()
+
+	localPts := p.channelPts[channelID]
+	if localPts > 0 && pts-ptsCount > localPts {
+		// fmt.Printf("[DEBUG] 检测到 pts 缺口 (channel=%d, local=%d, remote=%d, count=%d)\n", channelID, localPts, pts, ptsCount)
+		return true
+	}
+	if pts > localPts {
+		p.channelPts[channelID] = pts
+		p.channelStateDirty = true
+	}
+	return false
+}
+
+// triggerChannelCatchUp 异步补偿频道差异（同一频道同时只运行一个补偿）
+func (p *MessageProcessor) triggerChannelCatchUp(channelID int64, reason string) {
+	p.channelPtsMu.Lock()
+	if p.channelCatchingUp[channelID] {
+		p.channelPtsMu.Unlock()
+		return
+	}
+	p.channelCatchingUp[channelID] = true
+	p.channelPtsMu.Unlock()
+
+	go func() {
+		defer func() {
+			p.channelPtsMu.Lock()
+			delete(p.channelCatchingUp, channelID)
+			p.channelPtsMu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		fmt.Printf("🔁 开始补偿频道消息 (频道=%d, 原因=%s)\n", channelID, reason)
+		if err := p.catchUpChannel(ctx, channelID); err != nil {
+			fmt.Printf("❌ 补偿频道消息失败 (频道=%d): %v\n", channelID, err)
+		}
+	}()
+}
+
+// catchUpAllChannels 对所有监听频道执行一次差异补偿
+// 没有 pts 记录的频道仅初始化当前 pts（首次启动由历史消息功能覆盖）
+func (p *MessageProcessor) catchUpAllChannels(ctx context.Context) {
+	for _, channelID := range p.monitoredChannels() {
+		if p.getChannelPts(channelID) == 0 {
+			if err := p.initChannelPts(ctx, channelID); err != nil {
+				fmt.Printf("⚠️  初始化频道 pts 失败 (频道=%d): %v\n", channelID, err)
+			}
+			continue
+		}
+		if err := p.catchUpChannel(ctx, channelID); err != nil {
+			fmt.Printf("❌ 补偿频道消息失败 (频道=%d): %v\n", channelID, err)
+		}
+	}
+}
+
+// StartChannelCatchUpLoop 定期补偿所有监听频道，覆盖连接中断期间漏掉的更新
+func (p *MessageProcessor) StartChannelCatchUpLoop(ctx context.Context) {
+	ticker := time.NewTicker(channelCatchUpInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, channelID := range p.monitoredChannels() {
+				if p.getChannelPts(channelID) > 0 {
+					p.triggerChannelCatchUp(channelID, "定期检查")
+				}
+			}
+		}
+	}
+}
+
+// initChannelPts 通过 channels.getFullChannel 获取频道当前 pts
+func (p *MessageProcessor) initChannelPts(ctx context.Context, channelID int64) error {
+	channel, err := p.peers.Channel(ctx, channelID)
+	if err != nil {
+		return err
+	}
+
+	full, err := p.api.ChannelsGetFullChannel(ctx, channel.InputChannel())
+	if err != nil {
+		return fmt.Errorf("获取频道信息失败: %w", err)
+	}
+
+	channelFull, ok := full.FullChat.(*tg.ChannelFull)
+	if !ok {
+		return fmt.Errorf("频道信息类型错误")
+	}
+
+	p.setChannelPts(channelID, channelFull.GetPts())
+	// fmt.Printf("[DEBUG] 初始化频道 pts (channel=%d, pts=%d)\n", channelID, channelFull.GetPts())
+	return nil
+}
+
+// catchUpChannel 从已记录的 pts 开始调用 updates.getChannelDifference 拉取漏掉的消息
+// 补偿的消息与实时消息一样进入处理队列，保证同一频道内按顺序处理
+func (p *MessageProcessor) catchUpChannel(ctx context.Context, channelID int64) error {
+	pts := p.getChannelPts(channelID)
+	if pts == 0 {
+		return p.initChannelPts(ctx, channelID)
+	}
+
+	channel, err := p.peers.Channel(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	inputChannel := channel.InputChannel()
+
+	recovered := 0
+	for i := 0; i < channelCatchUpMaxLoops; i++ {
+		diff, err := p.api.UpdatesGetChannelDifference(ctx, &tg.UpdatesGetChannelDifferenceRequest{
+			Force:   true,
+			Channel: inputChannel,
+			Filter:  &tg.ChannelMessagesFilterEmpty{},
+			Pts:     pts,
+			Limit:   channelDifferenceLimit,
+		})
+		if err != nil {
+			return fmt.Errorf("获取频道差异失败: %w", err)
+		}
+
+		final := true
+		switch d := diff.(type) {
+		case *tg.UpdatesChannelDifferenceEmpty:
+			pts = d.Pts
+			final = d.Final
+		case *tg.UpdatesChannelDifference:
+			p.peers.CollectChats(d.Chats)
+			p.peers.CollectUsers(d.Users)
+			for _, m := range d.NewMessages {
+				if msg, ok := m.(*tg.Message); ok {
+					p.enqueueMessage(ctx, msg, tg.Entities{}, false)
+					recovered++
+				}
+			}
+			for _, u := range d.OtherUpdates {
+				if edit, ok := u.(*tg.UpdateEditChannelMessage); ok {
+					if msg, ok := edit.Message.(*tg.Message); ok {
+						p.enqueueMessage(ctx, msg, tg.Entities{}, true)
+						recovered++
+					}
+				}
+			}
+			pts = d.Pts
+			final = d.Final
+		case *tg.UpdatesChannelDifferenceTooLong:
+			// 差异过大，服务器只返回最新的一批消息，从对话的 pts 重新开始
+			p.peers.CollectChats(d.Chats)
+			p.peers.CollectUsers(d.Users)
+			for _, m := range d.Messages {
+				if msg, ok := m.(*tg.Message); ok {
+					p.enqueueMessage(ctx, msg, tg.Entities{}, false)
+					recovered++
+				}
+			}
+			if dialog, ok := d.Dialog.(*tg.Dialog); ok {
+				if dialogPts, ok := dialog.GetPts(); ok {
+					pts = dialogPts
+				}
+			}
+			fmt.Printf("⚠️  频道差异过大，已跳至最新状态 (频道=%d)\n", channelID)
+			final = true
+		}
+
+		p.setChannelPts(channelID, pts)
+		if final {
+			break
+		}
+	}
+
+	if recovered > 0 {
+		fmt.Printf("✅ 频道补偿完成 (频道=%d, 补偿消息=%d, pts=%d)\n", channelID, recovered, pts)
+	}
+	return nil
+}
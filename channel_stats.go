@@ -0,0 +1,136 @@
+// tdl-msgproce - 按频道统计处理结果
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChannelStats 单个频道的处理统计
+type ChannelStats struct {
+	Messages       int64            // 处理的消息数
+	Subscriptions  int64            // 成功提交的订阅数
+	Nodes          int64            // 成功提交的节点数
+	Duplicates     int64            // 按指纹跳过的重复节点数
+	Invalid        int64            // 校验失败被丢弃的节点数
+	Repaired       int64            // 经修复后保留的节点数
+	InvalidReasons map[string]int64 // 丢弃原因 -> 次数
+	SubRejected    int64            // 预检未通过的订阅数
+	SubFormats     map[string]int64 // 订阅预检识别的格式 -> 次数
+	SubDead        int64            // 已过期或流量耗尽而跳过的订阅数
+	Probed         int64            // 本地探测的节点数
+	Unreachable    int64            // 探测不可达被丢弃的节点数
+}
+
+// ChannelStatsTracker 按频道汇总处理统计（仅内存，重启后清零）
+type ChannelStatsTracker struct {
+	mu    sync.Mutex
+	stats map[int64]*ChannelStats
+}
+
+// NewChannelStatsTracker 创建频道统计
+func NewChannelStatsTracker() *ChannelStatsTracker {
+	return &ChannelStatsTracker{stats: make(map[int64]*ChannelStats)}
+}
+
+// Update 在锁内修改指定频道的统计
+func (t *ChannelStatsTracker) Update(channelID int64, fn func(s *ChannelStats)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.stats[channelID]
+	if !ok {
+		s = &ChannelStats{InvalidReasons: make(map[string]int64), SubFormats: make(map[string]int64)}
+		t.stats[channelID] = s
+	}
+	fn(s)
+}
+
+// RecordInvalid 记录一个被丢弃的无效节点及原因
+func (t *ChannelStatsTracker) RecordInvalid(channelID int64, reason string) {
+	t.Update(channelID, func(s *ChannelStats) {
+		s.Invalid++
+		s.InvalidReasons[reason]++
+	})
+}
+
+// Snapshot 返回所有频道统计的副本
+func (t *ChannelStatsTracker) Snapshot() map[int64]ChannelStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[int64]ChannelStats, len(t.stats))
+	for channelID, s := range t.stats {
+		copied := *s
+		copied.InvalidReasons = make(map[string]int64, len(s.InvalidReasons))
+		for reason, count := range s.InvalidReasons {
+			copied.InvalidReasons[reason] = count
+		}
+		copied.SubFormats = make(map[string]int64, len(s.SubFormats))
+		for format, count := range s.SubFormats {
+			copied.SubFormats[format] = count
+		}
+		result[channelID] = copied
+	}
+	return result
+}
+
+// formatChannelStats 生成按频道统计的文本（用于 /status），按提交节点数降序排列
+func (p *MessageProcessor) formatChannelStats() string {
+	snapshot := p.stats.Snapshot()
+	if len(snapshot) == 0 {
+		return ""
+	}
+
+	channelIDs := make([]int64, 0, len(snapshot))
+	for channelID := range snapshot {
+		channelIDs = append(channelIDs, channelID)
+	}
+	sort.Slice(channelIDs, func(i, j int) bool {
+		return snapshot[channelIDs[i]].Nodes > snapshot[channelIDs[j]].Nodes
+	})
+
+	var sb strings.Builder
+	sb.WriteString("\n\n📈 频道统计:")
+	for _, channelID := range channelIDs {
+		s := snapshot[channelID]
+		name := fmt.Sprintf("%d", channelID)
+		kind, ok := p.config.Monitor.PeerKinds[channelID]
+		if !ok {
+			kind = peerKindChannel
+		}
+		if peer, ok := p.peers.get(kind, channelID); ok && peer.Title != "" {
+			name = peer.Title
+		}
+		sb.WriteString(fmt.Sprintf("\n• %s: 消息 %d, 订阅 %d, 节点 %d, 重复 %d, 修复 %d, 无效 %d",
+			name, s.Messages, s.Subscriptions, s.Nodes, s.Duplicates, s.Repaired, s.Invalid))
+
+		if len(s.InvalidReasons) > 0 {
+			reasons := make([]string, 0, len(s.InvalidReasons))
+			for reason, count := range s.InvalidReasons {
+				reasons = append(reasons, fmt.Sprintf("%s×%d", reason, count))
+			}
+			sort.Strings(reasons)
+			sb.WriteString(fmt.Sprintf("\n  └ 无效原因: %s", strings.Join(reasons, ", ")))
+		}
+		if s.Probed > 0 {
+			sb.WriteString(fmt.Sprintf("\n  └ 节点探测: %d, 不可达 %d", s.Probed, s.Unreachable))
+		}
+		if len(s.SubFormats) > 0 || s.SubDead > 0 {
+			formats := make([]string, 0, len(s.SubFormats))
+			for format, count := range s.SubFormats {
+				formats = append(formats, fmt.Sprintf("%s×%d", format, count))
+			}
+			sort.Strings(formats)
+			sb.WriteString(fmt.Sprintf("\n  └ 订阅预检: %s (未通过 %d, 已失效 %d)", strings.Join(formats, ", "), s.SubRejected, s.SubDead))
+		}
+	}
+	return sb.String()
+}
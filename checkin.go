@@ -79,6 +79,11 @@ func (s *checkInScheduler) scheduleLoop(ctx context.Context) {
 // checkAndExecuteTasks 检查并执行需要执行的任务
 func (s *checkInScheduler) checkAndExecuteTasks(ctx context.Context, now time.Time) {
 	for i, task := range s.processor.config.CheckIn.Tasks {
+		// 机器人未能解析的任务跳过
+		if task.Bot == 0 {
+			continue
+		}
+
 		taskKey := fmt.Sprintf("task_%d_%d", i, task.Bot)
 
 		// 检查是否应该执行
@@ -226,21 +231,15 @@ func matchCronField(field string, value int, min int, max int) bool {
 
 // performCheckIn 执行签到
 func (s *checkInScheduler) performCheckIn(ctx context.Context, task CheckInTask) error {
-	// 获取 bot 的 AccessHash
-	accessHash, err := s.getBotAccessHash(ctx, task.Bot)
+	// 通过统一的对等体解析器获取 bot 的 AccessHash
+	bot, err := s.processor.peers.User(ctx, task.Bot)
 	if err != nil {
 		return fmt.Errorf("获取机器人AccessHash失败: %w", err)
 	}
 
-	// 创建 InputPeer
-	peer := &tg.InputPeerUser{
-		UserID:     task.Bot,
-		AccessHash: accessHash,
-	}
-
 	// 发送消息
 	_, err = s.processor.api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
-		Peer:    peer,
+		Peer:    bot.InputPeer(),
 		Message: task.Message,
 		RandomID: time.Now().UnixNano(),
 	})
@@ -251,37 +250,3 @@ func (s *checkInScheduler) performCheckIn(ctx context.Context, task CheckInTask)
 
 	return nil
 }
-
-// getBotAccessHash 从对话列表获取 bot 的 AccessHash
-func (s *checkInScheduler) getBotAccessHash(ctx context.Context, userID int64) (int64, error) {
-	// 获取对话列表
-	dialogs, err := s.processor.api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
-		OffsetDate: 0,
-		OffsetID:   0,
-		OffsetPeer: &tg.InputPeerEmpty{},
-		Limit:      100,
-		Hash:       0,
-	})
-
-	if err != nil {
-		return 0, fmt.Errorf("获取对话列表失败: %w", err)
-	}
-
-	// 查找对应的用户
-	switch d := dialogs.(type) {
-	case *tg.MessagesDialogs:
-		for _, user := range d.Users {
-			if u, ok := user.(*tg.User); ok && u.ID == userID {
-				return u.AccessHash, nil
-			}
-		}
-	case *tg.MessagesDialogsSlice:
-		for _, user := range d.Users {
-			if u, ok := user.(*tg.User); ok && u.ID == userID {
-				return u.AccessHash, nil
-			}
-		}
-	}
-
-	return 0, fmt.Errorf("未找到用户 %d，请确保已与该机器人建立过对话", userID)
-}
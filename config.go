@@ -19,6 +19,8 @@ type Config struct {
 	Monitor MonitorConfig `yaml:"monitor"`
 	Proxy   ProxyConfig   `yaml:"proxy"`
 	CheckIn CheckInConfig `yaml:"checkin"`
+
+	patterns patternSet // 加载时预编译的 re: 正则关键词（见 compileFilterRules）
 }
 
 // BotConfig Telegram Bot 配置
@@ -33,25 +35,82 @@ type BotConfig struct {
 // MonitorConfig 消息监听配置
 type MonitorConfig struct {
 	Enabled bool `yaml:"enabled"`
+	DryRun  bool `yaml:"dry_run"` // 演练模式：照常提取和过滤，只写入决策记录，不提交到任何输出目标
 
 	SubscriptionAPI struct {
 		ApiKey string `yaml:"api_key"`
 		AddURL string `yaml:"add_url"` // 添加订阅的完整 URL
+
+		Protocols []string `yaml:"protocols"` // 只提交这些协议的链接（留空提交全部）
 	} `yaml:"subscription_api"`
 
+	// 额外的输出目标（第二个订阅 API、本地文件、Telegram 会话），subscription_api 为名为 api 的默认输出
+	Sinks []SinkConfig `yaml:"sinks"`
+
+	// 异步处理流水线
+	Pipeline struct {
+		Workers   int `yaml:"workers"`    // 工作协程数（<=0 使用默认 4）
+		QueueSize int `yaml:"queue_size"` // 队列容量（<=0 使用默认 1000），队列满时反压
+	} `yaml:"pipeline"`
+
+	// 跨消息节点批量提交
+	Batching struct {
+		Enabled  bool `yaml:"enabled"`   // 是否汇总多条消息的节点后再提交
+		Window   int  `yaml:"window"`    // 批次窗口（秒，<=0 使用默认 30）
+		MaxNodes int  `yaml:"max_nodes"` // 批次最大节点数，达到后立即提交（<=0 使用默认 200）
+	} `yaml:"batching"`
+
 	Features struct {
 		FetchHistoryCount   int  `yaml:"fetch_history_count"`   // 获取历史消息数量（>0开启，<=0关闭）
 		AutoRecloneForwards bool `yaml:"auto_reclone_forwards"` // 是否自动克隆 forward_target 频道的转发消息
+		EditRetract         bool `yaml:"edit_retract"`          // 编辑消息移除链接时通知支持撤回的输出目标（节点集合）
+
+		// 文档附件扫描（仅监听频道）
+		DocumentScan struct {
+			Enabled   bool     `yaml:"enabled"`     // 是否下载并扫描文档附件
+			MaxSizeKB int      `yaml:"max_size_kb"` // 文档大小上限（KB，<=0 使用默认 512）
+			MimeTypes []string `yaml:"mime_types"`  // 允许扫描的 MIME 类型（留空使用默认列表）
+		} `yaml:"document_scan"`
+
+		// 订阅预检：提交前下载订阅并识别格式，只提交真正的订阅
+		SubscriptionCheck struct {
+			Enabled   bool `yaml:"enabled"`     // 是否启用订阅预检
+			Timeout   int  `yaml:"timeout"`     // 下载超时（秒，<=0 使用默认 15）
+			MaxSizeKB int  `yaml:"max_size_kb"` // 最大读取大小（KB，<=0 使用默认 4096）
+		} `yaml:"subscription_check"`
+
+		// 订阅流量记录：下载订阅读取 Subscription-Userinfo，过期或流量耗尽的订阅不再提交
+		SubscriptionInfo struct {
+			Enabled      bool `yaml:"enabled"`       // 是否下载订阅记录流量与到期信息
+			RecheckHours int  `yaml:"recheck_hours"` // 流量耗尽订阅的复查间隔（小时，<=0 使用默认 24）
+		} `yaml:"subscription_info"`
+
+		// 节点本地探测：提交前对节点做 TCP 连接（TLS 类协议再做 TLS 握手），过滤不可达的节点
+		NodeProbe struct {
+			Enabled     bool `yaml:"enabled"`     // 是否启用节点探测
+			Timeout     int  `yaml:"timeout"`     // 单个节点的探测超时（秒，<=0 使用默认 5）
+			Concurrency int  `yaml:"concurrency"` // 最大并发探测数（<=0 使用默认 16）
+		} `yaml:"node_probe"`
 	} `yaml:"features"`
 
-	Channels          []int64 `yaml:"channels"`
-	WhitelistChannels []int64 `yaml:"whitelist_channels"`
+	// 频道可填写数字ID、@username、https://t.me/name 或 t.me/+invite，启动时统一解析为ID
+	// channels 条目也可以写成对象，携带频道级的过滤和路由覆盖（见 ChannelEntry）
+	ChannelRefs       []ChannelEntry          `yaml:"channels"`
+	WhitelistRefs     []string                `yaml:"whitelist_channels"`
+	Channels          []int64                 `yaml:"-"` // 解析后的监听频道ID
+	WhitelistChannels []int64                 `yaml:"-"` // 解析后的白名单频道ID
+	ChannelOverrides  map[int64]*ChannelEntry `yaml:"-"` // 解析后的频道ID -> 覆盖规则
+	PeerKinds         map[int64]string        `yaml:"-"` // 监听ID -> 类型（channel / chat / user），未知类型按频道处理
+	SinkNames         map[string]bool         `yaml:"-"` // 可用的输出目标名称（api 及 monitor.sinks 中有效的名称，由 validateSinkConfigs 登记）
 
 	Filters struct {
 		Subs          []string `yaml:"subs"`           // 订阅格式过滤（需要二次过滤）
 		SS            []string `yaml:"ss"`             // 节点格式过滤（不需要二次过滤）
 		ContentFilter []string `yaml:"content_filter"` // 二次内容过滤（仅对订阅生效）
 		LinkBlacklist []string `yaml:"link_blacklist"`
+
+		// content_filter 和 link_blacklist 支持 re: 前缀的正则表达式（subs / ss 为协议前缀，不支持）；Rules 为基于表达式的链接过滤规则
+		Rules []FilterRule `yaml:"rules"`
 	} `yaml:"filters"`
 }
 
@@ -73,7 +132,8 @@ type CheckInConfig struct {
 
 // CheckInTask 单个签到任务
 type CheckInTask struct {
-	Bot     int64  `yaml:"bot"`     // 机器人用户ID
+	BotRef  string `yaml:"bot"`     // 机器人：数字ID、@username 或 https://t.me/name
+	Bot     int64  `yaml:"-"`       // 解析后的机器人用户ID（0 表示未解析）
 	Message string `yaml:"message"` // 签到消息内容
 	Cron    string `yaml:"cron"`    // Cron表达式（分 时 日 月 周）
 }
@@ -90,12 +150,48 @@ func loadConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
 
+	// 预编译正则关键词和表达式规则，配置错误时直接报错
+	if err := compileFilterRules(&config); err != nil {
+		return nil, fmt.Errorf("过滤规则无效: %w", err)
+	}
+
+	// 数字ID无需联网即可确定，先行填入；用户名和邀请链接在启动时解析
+	applyNumericPeerRefs(&config)
+
 	// 自动检测并禁用未配置的功能
 	validateAndDisableFeatures(&config)
 
 	return &config, nil
 }
 
+// applyNumericPeerRefs 将配置中的数字ID引用直接填入解析结果
+func applyNumericPeerRefs(config *Config) {
+	config.Monitor.ChannelOverrides = make(map[int64]*ChannelEntry)
+	config.Monitor.PeerKinds = make(map[int64]string)
+	for i := range config.Monitor.ChannelRefs {
+		entry := &config.Monitor.ChannelRefs[i]
+		if ref := parsePeerRef(entry.Ref); ref.Kind == peerRefID {
+			config.Monitor.Channels = append(config.Monitor.Channels, ref.ID)
+			if ref.Hint != "" {
+				config.Monitor.PeerKinds[ref.ID] = ref.Hint
+			}
+			if entry.HasOverrides() {
+				config.Monitor.ChannelOverrides[ref.ID] = entry
+			}
+		}
+	}
+	for _, raw := range config.Monitor.WhitelistRefs {
+		if ref := parsePeerRef(raw); ref.Kind == peerRefID {
+			config.Monitor.WhitelistChannels = append(config.Monitor.WhitelistChannels, ref.ID)
+		}
+	}
+	for i := range config.CheckIn.Tasks {
+		if ref := parsePeerRef(config.CheckIn.Tasks[i].BotRef); ref.Kind == peerRefID {
+			config.CheckIn.Tasks[i].Bot = ref.ID
+		}
+	}
+}
+
 // validateAndDisableFeatures 验证并自动禁用未配置的功能
 func validateAndDisableFeatures(config *Config) {
 	// 检查 Bot 配置
@@ -111,17 +207,49 @@ func validateAndDisableFeatures(config *Config) {
 	// 检查 Monitor 配置
 	monitorValid := true
 
-	// 检查订阅 API 配置
+	// 检查输出目标配置
+	validateSinkConfigs(config)
+	extraSinks := 0
+	for _, sink := range config.Monitor.Sinks {
+		if sink.Enabled {
+			extraSinks++
+		}
+	}
+
+	// 检查订阅 API 配置（配置了其他输出目标时订阅 API 可以留空）
 	if config.Monitor.SubscriptionAPI.ApiKey == "" ||
 		config.Monitor.SubscriptionAPI.ApiKey == "YOUR_API_KEY" ||
 		config.Monitor.SubscriptionAPI.AddURL == "" ||
 		config.Monitor.SubscriptionAPI.AddURL == "YOUR_API_ADD_URL" {
-		monitorValid = false
-		if config.Monitor.Enabled {
-			fmt.Println("⚠️  订阅 API 配置未完成，自动禁用 Monitor 功能")
+		config.Monitor.SubscriptionAPI.AddURL = ""
+		if extraSinks == 0 && !config.Monitor.DryRun {
+			monitorValid = false
+			if config.Monitor.Enabled {
+				fmt.Println("⚠️  订阅 API 配置未完成，自动禁用 Monitor 功能")
+			}
+		}
+	}
+
+	// 检查频道级输出目标
+	for i := range config.Monitor.ChannelRefs {
+		entry := &config.Monitor.ChannelRefs[i]
+		if entry.Sink != "" && !config.Monitor.SinkNames[entry.Sink] {
+			fmt.Printf("⚠️  频道 %s 的输出目标 %q 不存在，已忽略\n", entry.Ref, entry.Sink)
+			entry.Sink = ""
+		}
+		var sinks []string
+		for _, name := range entry.Sinks {
+			if config.Monitor.SinkNames[name] {
+				sinks = append(sinks, name)
+			} else {
+				fmt.Printf("⚠️  频道 %s 的输出目标 %q 不存在，已忽略\n", entry.Ref, name)
+			}
 		}
-	} // 检查是否有监听频道
-	if len(config.Monitor.Channels) == 0 {
+		entry.Sinks = sinks
+	}
+
+	// 检查是否有监听频道
+	if len(config.Monitor.ChannelRefs) == 0 {
 		monitorValid = false
 		if config.Monitor.Enabled {
 			fmt.Println("⚠️  未配置监听频道，自动禁用 Monitor 功能")
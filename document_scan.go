@@ -0,0 +1,538 @@
+// tdl-msgproce - 文档附件扫描（txt / Clash YAML / sing-box JSON 节点提取）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultDocumentMaxSizeKB = 512              // 默认文档大小上限（KB）
+	documentDownloadTimeout  = 60 * time.Second // 单个文档下载超时
+)
+
+// defaultDocumentMimeTypes 默认允许扫描的文档 MIME 类型
+var defaultDocumentMimeTypes = []string{
+	"text/plain",
+	"text/yaml",
+	"text/x-yaml",
+	"application/yaml",
+	"application/x-yaml",
+	"application/json",
+}
+
+// documentExtensions 按扩展名识别的文本文档（Telegram 常把 yaml/conf 标记为 application/octet-stream）
+var documentExtensions = []string{".txt", ".yaml", ".yml", ".json", ".conf", ".list"}
+
+// errDocumentTooLarge 文档超过大小上限
+var errDocumentTooLarge = errors.New("文档超过大小上限")
+
+// limitedBuffer 限制写入大小的缓冲区，超出上限时返回错误中止下载
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.limit {
+		return 0, errDocumentTooLarge
+	}
+	return b.buf.Write(p)
+}
+
+// scanMessageDocument 下载监听频道消息中的小型文本文档并提取内容
+// 返回文档原文及从 Clash YAML / sing-box JSON 转换出的节点链接（每行一个），不符合条件时返回空字符串
+func (p *MessageProcessor) scanMessageDocument(ctx context.Context, msg *tg.Message, peerID int64) string {
+	scan := p.config.Monitor.Features.DocumentScan
+	if !scan.Enabled || !contains(p.config.Monitor.Channels, peerID) {
+		return ""
+	}
+
+	media, ok := msg.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return ""
+	}
+	doc, ok := media.Document.(*tg.Document)
+	if !ok {
+		return ""
+	}
+
+	fileName := ""
+	for _, attr := range doc.Attributes {
+		if a, ok := attr.(*tg.DocumentAttributeFilename); ok {
+			fileName = a.FileName
+		}
+	}
+
+	if !isScannableDocument(doc.MimeType, fileName, scan.MimeTypes) {
+		// fmt.Printf("[DEBUG] 文档类型不在扫描范围 (message_id=%d, mime=%s, file=%s)\n", msg.ID, doc.MimeType, fileName)
+		return ""
+	}
+
+	maxSizeKB := scan.MaxSizeKB
+	if maxSizeKB <= 0 {
+		maxSizeKB = defaultDocumentMaxSizeKB
+	}
+	if doc.Size > int64(maxSizeKB)*1024 {
+		fmt.Printf("⏭️  文档超过大小上限，跳过扫描 (ID=%d, 文件=%s, 大小=%dKB, 上限=%dKB)\n", msg.ID, fileName, doc.Size/1024, maxSizeKB)
+		return ""
+	}
+
+	downloadCtx, cancel := context.WithTimeout(ctx, documentDownloadTimeout)
+	defer cancel()
+
+	output := &limitedBuffer{limit: maxSizeKB * 1024}
+	location := &tg.InputDocumentFileLocation{
+		ID:            doc.ID,
+		AccessHash:    doc.AccessHash,
+		FileReference: doc.FileReference,
+	}
+	if _, err := downloader.NewDownloader().Download(p.api, location).Stream(downloadCtx, output); err != nil {
+		fmt.Printf("❌ 下载文档失败 (ID=%d, 文件=%s): %v\n", msg.ID, fileName, err)
+		return ""
+	}
+
+	data := output.buf.Bytes()
+	nodes := convertStructuredNodes(data)
+	fmt.Printf("📄 已扫描文档附件 (ID=%d, 文件=%s, 大小=%dB, 结构化节点=%d)\n", msg.ID, fileName, len(data), len(nodes))
+
+	if len(nodes) == 0 {
+		return string(data)
+	}
+	return string(data) + "\n" + strings.Join(nodes, "\n")
+}
+
+// isScannableDocument 判断文档是否在 MIME 白名单内（或扩展名为常见文本配置格式）
+func isScannableDocument(mimeType string, fileName string, allowlist []string) bool {
+	if len(allowlist) == 0 {
+		allowlist = defaultDocumentMimeTypes
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	for _, allowed := range allowlist {
+		if mimeType == strings.ToLower(strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		ext := strings.ToLower(filepath.Ext(fileName))
+		for _, allowed := range documentExtensions {
+			if ext == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// structuredNode Clash / sing-box 节点定义的统一中间表示，用于转换为分享链接
+type structuredNode struct {
+	Type         string // ss / vmess / vless / trojan / hysteria / hysteria2 / tuic
+	Name         string
+	Server       string
+	Port         int
+	UUID         string
+	Password     string
+	Cipher       string
+	AlterID      int
+	Network      string // tcp / ws / grpc / h2
+	Path         string
+	Host         string
+	ServiceName  string
+	TLS          bool
+	SNI          string
+	Insecure     bool
+	Flow         string
+	RealityKey   string
+	RealityID    string
+	Fingerprint  string
+	Obfs         string
+	ObfsPassword string
+	Congestion   string
+	ALPN         []string
+	UpMbps       int
+	DownMbps     int
+}
+
+// convertStructuredNodes 识别 Clash YAML（proxies）或 sing-box JSON（outbounds）并转换为分享链接
+// JSON 是 YAML 的子集，统一使用 YAML 解析
+func convertStructuredNodes(data []byte) []string {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+
+	var nodes []structuredNode
+	if proxies, ok := doc["proxies"].([]interface{}); ok {
+		for _, item := range proxies {
+			if m, ok := item.(map[string]interface{}); ok {
+				if node, ok := parseClashProxy(m); ok {
+					nodes = append(nodes, node)
+				}
+			}
+		}
+	}
+	if outbounds, ok := doc["outbounds"].([]interface{}); ok {
+		for _, item := range outbounds {
+			if m, ok := item.(map[string]interface{}); ok {
+				if node, ok := parseSingBoxOutbound(m); ok {
+					nodes = append(nodes, node)
+				}
+			}
+		}
+	}
+
+	var links []string
+	for _, node := range nodes {
+		if link := node.URI(); link != "" {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// parseClashProxy 解析 Clash proxies 列表中的单个节点
+func parseClashProxy(m map[string]interface{}) (structuredNode, bool) {
+	node := structuredNode{
+		Type:        strings.ToLower(mapString(m, "type")),
+		Name:        mapString(m, "name"),
+		Server:      mapString(m, "server"),
+		Port:        mapInt(m, "port"),
+		UUID:        mapString(m, "uuid"),
+		Password:    mapString(m, "password"),
+		Cipher:      mapString(m, "cipher"),
+		AlterID:     mapInt(m, "alterId"),
+		Network:     mapString(m, "network"),
+		TLS:         mapBool(m, "tls"),
+		SNI:         firstNonEmpty(mapString(m, "servername"), mapString(m, "sni")),
+		Insecure:    mapBool(m, "skip-cert-verify"),
+		Flow:        mapString(m, "flow"),
+		Fingerprint: mapString(m, "client-fingerprint"),
+		Obfs:        mapString(m, "obfs"),
+		Congestion:  mapString(m, "congestion-controller"),
+		ALPN:        mapStrings(m, "alpn"),
+		UpMbps:      mapInt(m, "up"),
+		DownMbps:    mapInt(m, "down"),
+	}
+
+	switch node.Type {
+	case "hysteria2":
+		node.ObfsPassword = mapString(m, "obfs-password")
+		node.TLS = true
+	case "hysteria":
+		node.Password = firstNonEmpty(mapString(m, "auth-str"), mapString(m, "auth_str"))
+	case "trojan", "tuic":
+		node.TLS = true
+	}
+
+	if ws, ok := m["ws-opts"].(map[string]interface{}); ok {
+		node.Path = mapString(ws, "path")
+		if headers, ok := ws["headers"].(map[string]interface{}); ok {
+			node.Host = mapString(headers, "Host")
+		}
+	}
+	if grpc, ok := m["grpc-opts"].(map[string]interface{}); ok {
+		node.ServiceName = mapString(grpc, "grpc-service-name")
+	}
+	if reality, ok := m["reality-opts"].(map[string]interface{}); ok {
+		node.RealityKey = mapString(reality, "public-key")
+		node.RealityID = mapString(reality, "short-id")
+	}
+
+	return node, node.Server != "" && node.Port > 0
+}
+
+// parseSingBoxOutbound 解析 sing-box outbounds 列表中的单个出站
+func parseSingBoxOutbound(m map[string]interface{}) (structuredNode, bool) {
+	node := structuredNode{
+		Type:       strings.ToLower(mapString(m, "type")),
+		Name:       mapString(m, "tag"),
+		Server:     mapString(m, "server"),
+		Port:       mapInt(m, "server_port"),
+		UUID:       mapString(m, "uuid"),
+		Password:   mapString(m, "password"),
+		Cipher:     mapString(m, "method"),
+		AlterID:    mapInt(m, "alter_id"),
+		Flow:       mapString(m, "flow"),
+		Congestion: mapString(m, "congestion_control"),
+		UpMbps:     mapInt(m, "up_mbps"),
+		DownMbps:   mapInt(m, "down_mbps"),
+	}
+
+	switch node.Type {
+	case "shadowsocks":
+		node.Type = "ss"
+	case "hysteria":
+		node.Password = mapString(m, "auth_str")
+		node.Obfs = mapString(m, "obfs")
+	case "hysteria2":
+		if obfs, ok := m["obfs"].(map[string]interface{}); ok {
+			node.Obfs = mapString(obfs, "type")
+			node.ObfsPassword = mapString(obfs, "password")
+		}
+	}
+
+	if tls, ok := m["tls"].(map[string]interface{}); ok {
+		node.TLS = mapBool(tls, "enabled")
+		node.SNI = mapString(tls, "server_name")
+		node.Insecure = mapBool(tls, "insecure")
+		node.ALPN = mapStrings(tls, "alpn")
+		if utls, ok := tls["utls"].(map[string]interface{}); ok {
+			node.Fingerprint = mapString(utls, "fingerprint")
+		}
+		if reality, ok := tls["reality"].(map[string]interface{}); ok && mapBool(reality, "enabled") {
+			node.RealityKey = mapString(reality, "public_key")
+			node.RealityID = mapString(reality, "short_id")
+		}
+	}
+	if transport, ok := m["transport"].(map[string]interface{}); ok {
+		node.Network = mapString(transport, "type")
+		node.Path = mapString(transport, "path")
+		node.ServiceName = mapString(transport, "service_name")
+		if headers, ok := transport["headers"].(map[string]interface{}); ok {
+			node.Host = mapString(headers, "Host")
+		}
+		if node.Network == "http" {
+			node.Network = "h2"
+		}
+	}
+
+	return node, node.Server != "" && node.Port > 0
+}
+
+// URI 将节点转换为标准分享链接，不支持的协议返回空字符串
+func (n structuredNode) URI() string {
+	hostPort := net.JoinHostPort(n.Server, strconv.Itoa(n.Port))
+	fragment := ""
+	if n.Name != "" {
+		fragment = "#" + url.PathEscape(n.Name)
+	}
+
+	query := url.Values{}
+	if n.SNI != "" {
+		query.Set("sni", n.SNI)
+	}
+	if n.Insecure {
+		query.Set("insecure", "1")
+	}
+	if len(n.ALPN) > 0 {
+		query.Set("alpn", strings.Join(n.ALPN, ","))
+	}
+	n.addTransportQuery(query)
+
+	switch n.Type {
+	case "ss":
+		if n.Cipher == "" || n.Password == "" {
+			return ""
+		}
+		userInfo := base64.RawURLEncoding.EncodeToString([]byte(n.Cipher + ":" + n.Password))
+		return "ss://" + userInfo + "@" + hostPort + fragment
+
+	case "vmess":
+		if n.UUID == "" {
+			return ""
+		}
+		network := n.Network
+		if network == "" {
+			network = "tcp"
+		}
+		tls := ""
+		if n.TLS {
+			tls = "tls"
+		}
+		path := n.Path
+		if network == "grpc" {
+			path = n.ServiceName
+		}
+		data, err := json.Marshal(map[string]string{
+			"v":    "2",
+			"ps":   n.Name,
+			"add":  n.Server,
+			"port": strconv.Itoa(n.Port),
+			"id":   n.UUID,
+			"aid":  strconv.Itoa(n.AlterID),
+			"scy":  firstNonEmpty(n.Cipher, "auto"),
+			"net":  network,
+			"type": "none",
+			"host": n.Host,
+			"path": path,
+			"tls":  tls,
+			"sni":  n.SNI,
+		})
+		if err != nil {
+			return ""
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString(data)
+
+	case "vless":
+		if n.UUID == "" {
+			return ""
+		}
+		query.Set("encryption", "none")
+		switch {
+		case n.RealityKey != "":
+			query.Set("security", "reality")
+			query.Set("pbk", n.RealityKey)
+			if n.RealityID != "" {
+				query.Set("sid", n.RealityID)
+			}
+		case n.TLS:
+			query.Set("security", "tls")
+		}
+		if n.Flow != "" {
+			query.Set("flow", n.Flow)
+		}
+		if n.Fingerprint != "" {
+			query.Set("fp", n.Fingerprint)
+		}
+		return "vless://" + url.PathEscape(n.UUID) + "@" + hostPort + "?" + query.Encode() + fragment
+
+	case "trojan":
+		if n.Password == "" {
+			return ""
+		}
+		if n.Fingerprint != "" {
+			query.Set("fp", n.Fingerprint)
+		}
+		return "trojan://" + url.PathEscape(n.Password) + "@" + hostPort + "?" + query.Encode() + fragment
+
+	case "hysteria2", "hy2":
+		if n.Obfs != "" {
+			query.Set("obfs", n.Obfs)
+			query.Set("obfs-password", n.ObfsPassword)
+		}
+		userInfo := ""
+		if n.Password != "" {
+			userInfo = url.PathEscape(n.Password) + "@"
+		}
+		return "hysteria2://" + userInfo + hostPort + "?" + query.Encode() + fragment
+
+	case "hysteria":
+		if n.Password != "" {
+			query.Set("auth", n.Password)
+		}
+		if n.Obfs != "" {
+			query.Set("obfsParam", n.Obfs)
+		}
+		if n.UpMbps > 0 {
+			query.Set("upmbps", strconv.Itoa(n.UpMbps))
+		}
+		if n.DownMbps > 0 {
+			query.Set("downmbps", strconv.Itoa(n.DownMbps))
+		}
+		return "hysteria://" + hostPort + "?" + query.Encode() + fragment
+
+	case "tuic":
+		if n.UUID == "" {
+			return ""
+		}
+		if n.Congestion != "" {
+			query.Set("congestion_control", n.Congestion)
+		}
+		return "tuic://" + url.PathEscape(n.UUID) + ":" + url.PathEscape(n.Password) + "@" + hostPort + "?" + query.Encode() + fragment
+	}
+	return ""
+}
+
+// addTransportQuery 写入 vless / trojan 链接中的传输层参数
+func (n structuredNode) addTransportQuery(query url.Values) {
+	if n.Network == "" || n.Network == "tcp" {
+		return
+	}
+	query.Set("type", n.Network)
+	if n.Path != "" {
+		query.Set("path", n.Path)
+	}
+	if n.Host != "" {
+		query.Set("host", n.Host)
+	}
+	if n.ServiceName != "" {
+		query.Set("serviceName", n.ServiceName)
+	}
+}
+
+// mapString 读取字符串字段（兼容数字类型）
+func mapString(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// mapInt 读取整数字段（兼容字符串类型）
+func mapInt(m map[string]interface{}, key string) int {
+	switch v := m[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(v))
+		return n
+	}
+	return 0
+}
+
+// mapBool 读取布尔字段
+func mapBool(m map[string]interface{}, key string) bool {
+	switch v := m[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true" || v == "1"
+	}
+	return false
+}
+
+// mapStrings 读取字符串列表字段（兼容逗号分隔的字符串）
+func mapStrings(m map[string]interface{}, key string) []string {
+	switch v := m[key].(type) {
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				result = append(result, s)
+			}
+		}
+		return result
+	case string:
+		if v != "" {
+			return strings.Split(v, ",")
+		}
+	}
+	return nil
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,232 @@
+// tdl-msgproce - 监听演练模式（只记录处理决策，不提交）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gotd/td/tg"
+)
+
+const dryRunTextLimit = 500 // 决策记录中保留的消息文本长度（字符）
+
+// 决策记录中的处理阶段（跳过时记录在 skipped_by，通过时追加到 passed）
+const (
+	dryRunStageEmpty    = "empty"          // 空消息
+	dryRunStageFormat   = "format"         // 订阅 / 节点格式
+	dryRunStageContent  = "content_filter" // 二次内容过滤
+	dryRunStageLinks    = "links"          // 链接提取
+	dryRunStageBlack    = "link_blacklist" // 链接黑名单
+	dryRunStageRules    = "rules"          // 表达式规则
+	dryRunStageProtocol = "protocols"      // 频道协议白名单
+	dryRunStageEdit     = "edit_diff"      // 编辑消息没有新增链接
+	dryRunStageNodes    = "nodes"          // 节点校验、去重和探测
+	dryRunStageSinks    = "sinks"          // 订阅预检或输出目标（没有可提交的链接）
+)
+
+// DryRunLink 决策记录中的单个链接
+type DryRunLink struct {
+	Link    string   `json:"link"`
+	Kind    string   `json:"kind"`              // subscription / node
+	Sinks   []string `json:"sinks"`             // 将会提交到的输出目标
+	Skipped string   `json:"skipped,omitempty"` // 提交前被跳过的原因（订阅预检、已失效等）
+}
+
+// DryRunRecord 一条消息的处理决策
+type DryRunRecord struct {
+	Time      string       `json:"time"`
+	ChannelID int64        `json:"channel_id"`
+	MessageID int          `json:"message_id"`
+	Edited    bool         `json:"edited"`
+	Text      string       `json:"text"`
+	Rules     string       `json:"rules,omitempty"`      // 频道生效的规则摘要
+	Decision  string       `json:"decision"`             // skip / submit
+	Passed    []string     `json:"passed,omitempty"`     // 已通过的过滤阶段
+	SkippedBy string       `json:"skipped_by,omitempty"` // 跳过消息的过滤阶段
+	Found     []string     `json:"found,omitempty"`      // 提取到的全部链接
+	Links     []DryRunLink `json:"links,omitempty"`      // 通过过滤、将会提交的链接
+	Removed   []string     `json:"removed,omitempty"`    // 编辑后移除的链接
+}
+
+// pass 记录通过的过滤阶段（未启用演练模式时 r 为 nil）
+func (r *DryRunRecord) pass(stage string) {
+	if r != nil {
+		r.Passed = append(r.Passed, stage)
+	}
+}
+
+// skip 记录跳过消息的过滤阶段
+func (r *DryRunRecord) skip(stage string) {
+	if r != nil {
+		r.Decision = "skip"
+		r.SkippedBy = stage
+	}
+}
+
+// addLink 记录一个将会提交的链接
+func (r *DryRunRecord) addLink(link DryRunLink) {
+	if r != nil {
+		r.Decision = "submit"
+		r.Links = append(r.Links, link)
+	}
+}
+
+// skipLink 记录一个在提交前被跳过的链接
+func (r *DryRunRecord) skipLink(link DryRunLink) {
+	if r != nil {
+		r.Links = append(r.Links, link)
+	}
+}
+
+// DryRunRecorder 以 JSON Lines 追加写入决策记录（离线回放时只保存在内存中）
+type DryRunRecorder struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	records []*DryRunRecord // 内存模式下的记录（file 为 nil）
+	count   int64
+}
+
+// NewDryRunRecorder 打开（追加）决策记录文件
+func NewDryRunRecorder(path string) (*DryRunRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &DryRunRecorder{path: path, file: file}, nil
+}
+
+// newMemoryDryRunRecorder 创建只保存在内存中的决策记录（用于离线回放）
+func newMemoryDryRunRecorder() *DryRunRecorder {
+	return &DryRunRecorder{}
+}
+
+// Write 写入一条决策记录
+func (d *DryRunRecorder) Write(record *DryRunRecord) {
+	if d.file == nil {
+		d.mu.Lock()
+		d.records = append(d.records, record)
+		d.count++
+		d.mu.Unlock()
+		return
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		fmt.Printf("⚠️  序列化演练记录失败: %v\n", err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.file.Write(append(data, '\n')); err != nil {
+		fmt.Printf("⚠️  写入演练记录失败: %v\n", err)
+		return
+	}
+	d.count++
+}
+
+// Count 返回本次运行写入的记录数
+func (d *DryRunRecorder) Count() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.count
+}
+
+// Records 返回内存模式下的全部记录
+func (d *DryRunRecorder) Records() []*DryRunRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*DryRunRecord(nil), d.records...)
+}
+
+// Close 关闭记录文件
+func (d *DryRunRecorder) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	return d.file.Close()
+}
+
+// newDryRunRecord 创建消息的决策记录，未启用演练模式时返回 nil
+// 时间使用消息日期（回放导出记录时结果可重复），缺少日期时使用当前时间
+func (p *MessageProcessor) newDryRunRecord(channelID int64, msg *tg.Message, isEdited bool) *DryRunRecord {
+	if p.dryRun == nil {
+		return nil
+	}
+	text := msg.Message
+	if utf8.RuneCountInString(text) > dryRunTextLimit {
+		text = string([]rune(text)[:dryRunTextLimit]) + "…"
+	}
+	at := time.Now()
+	if msg.Date > 0 {
+		at = time.Unix(int64(msg.Date), 0)
+	}
+	return &DryRunRecord{
+		Time:      at.Format(time.RFC3339),
+		ChannelID: channelID,
+		MessageID: msg.ID,
+		Edited:    isEdited,
+		Text:      text,
+		Decision:  "skip",
+	}
+}
+
+// writeDryRunRecord 写入决策记录（record 为 nil 时忽略）
+func (p *MessageProcessor) writeDryRunRecord(record *DryRunRecord) {
+	if record != nil {
+		p.dryRun.Write(record)
+	}
+}
+
+// dryRunSubmit 演练模式下代替提交：记录每个链接将会发送到的输出目标，返回 (订阅数, 节点数)
+func (p *MessageProcessor) dryRunSubmit(record *DryRunRecord, sinks []Sink, subscriptions []string, nodes []string) (int, int) {
+	accepting := func(link string) []string {
+		names := []string{}
+		for _, sink := range sinks {
+			if sink.Accepts(link) {
+				names = append(names, sink.Name())
+			}
+		}
+		return names
+	}
+
+	counts := map[string]int{}
+	var accepted []string
+	add := func(link string, kind string) {
+		names := accepting(link)
+		if len(names) == 0 {
+			record.skipLink(DryRunLink{Link: link, Kind: kind, Sinks: names, Skipped: "没有接受该链接的输出目标"})
+			return
+		}
+		counts[kind]++
+		record.addLink(DryRunLink{Link: link, Kind: kind, Sinks: names})
+		if kind == "node" {
+			accepted = append(accepted, link)
+		}
+	}
+	for _, link := range subscriptions {
+		add(link, "subscription")
+	}
+	for _, link := range nodes {
+		add(link, "node")
+	}
+
+	// 离线回放使用独立的指纹缓存，模拟提交成功后的去重；实时演练不写入持久化的指纹缓存
+	if p.dryRun.file == nil {
+		p.nodeDedup.Mark(accepted)
+	}
+	return counts["subscription"], counts["node"]
+}
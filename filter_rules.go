@@ -0,0 +1,218 @@
+// tdl-msgproce - 正则与表达式过滤规则
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/gotd/td/tg"
+)
+
+const regexPatternPrefix = "re:" // 以 re: 开头的过滤关键词按正则表达式匹配（不区分大小写）
+
+// patternSet 预编译的 re: 正则关键词（关键词 -> 正则），随配置保存，加载后只读
+type patternSet map[string]*regexp.Regexp
+
+// FilterRule 基于表达式的链接过滤规则
+// 表达式可用字段: text, channel_id, has_media, is_forward, forward_from, link, host, protocol
+// 例如: link endsWith ".jpg"、host == "t.me"、protocol == "vmess" && channel_id == 123456、text matches "(?i)免费"
+type FilterRule struct {
+	Name   string `yaml:"name"`   // 规则名称（用于日志）
+	Expr   string `yaml:"expr"`   // 布尔表达式
+	Action string `yaml:"action"` // drop：丢弃匹配的链接（默认）；keep：只保留匹配任一 keep 规则的链接
+
+	program *vm.Program
+}
+
+// RuleEnv 规则表达式的求值环境
+type RuleEnv struct {
+	Text        string `expr:"text"`         // 消息完整文本（含隐藏链接、文档和解码内容）
+	ChannelID   int64  `expr:"channel_id"`   // 频道/群组ID
+	HasMedia    bool   `expr:"has_media"`    // 是否带媒体
+	IsForward   bool   `expr:"is_forward"`   // 是否为转发消息
+	ForwardFrom int64  `expr:"forward_from"` // 转发来源ID（非转发或隐藏来源时为 0）
+	Link        string `expr:"link"`         // 当前链接
+	Host        string `expr:"host"`         // 链接主机名（小写）
+	Protocol    string `expr:"protocol"`     // 链接协议（小写）
+}
+
+// compile 预编译 re: 开头的正则关键词
+func (s patternSet) compile(pattern string) error {
+	if !strings.HasPrefix(pattern, regexPatternPrefix) {
+		return nil
+	}
+	if _, ok := s[pattern]; ok {
+		return nil
+	}
+	re, err := regexp.Compile("(?i)" + strings.TrimPrefix(pattern, regexPatternPrefix))
+	if err != nil {
+		return fmt.Errorf("正则 %q 无效: %w", pattern, err)
+	}
+	s[pattern] = re
+	return nil
+}
+
+// compileRules 编译表达式规则
+func compileRules(rules []FilterRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("规则%d", i+1)
+		}
+		switch rule.Action {
+		case "":
+			rule.Action = "drop"
+		case "drop", "keep":
+		default:
+			return fmt.Errorf("规则 %q 的 action %q 无效（可选 drop / keep）", rule.Name, rule.Action)
+		}
+
+		program, err := expr.Compile(rule.Expr, expr.Env(RuleEnv{}), expr.AsBool())
+		if err != nil {
+			return fmt.Errorf("规则 %q 的表达式无效:\n%v", rule.Name, err)
+		}
+		rule.program = program
+	}
+	return nil
+}
+
+// compileFilterRules 在配置加载时编译所有正则关键词和表达式规则（包括频道级覆盖）
+// subs / ss 是协议前缀列表（用于构建链接提取正则和区分节点），不支持 re: 正则
+func compileFilterRules(config *Config) error {
+	filters := &config.Monitor.Filters
+	for _, prefixes := range [][]string{filters.Subs, filters.SS} {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(prefix, regexPatternPrefix) {
+				return fmt.Errorf("subs / ss 只支持协议前缀（如 \"vmess://\"），不支持正则 %q", prefix)
+			}
+		}
+	}
+	compiled := make(patternSet)
+	patternLists := [][]string{filters.ContentFilter, filters.LinkBlacklist}
+	for i := range config.Monitor.ChannelRefs {
+		entry := &config.Monitor.ChannelRefs[i]
+		patternLists = append(patternLists, entry.ContentFilter, entry.LinkBlacklist)
+		if err := compileRules(entry.Rules); err != nil {
+			return fmt.Errorf("频道 %s: %w", entry.Ref, err)
+		}
+	}
+	for _, patterns := range patternLists {
+		for _, pattern := range patterns {
+			if err := compiled.compile(pattern); err != nil {
+				return err
+			}
+		}
+	}
+	config.patterns = compiled
+	return compileRules(filters.Rules)
+}
+
+// match 判断文本是否匹配关键词：re: 开头按正则匹配，其余按不区分大小写的子串匹配
+func (s patternSet) match(text string, pattern string) bool {
+	if re, ok := s[pattern]; ok {
+		return re.MatchString(text)
+	}
+	return strings.Contains(strings.ToLower(text), strings.ToLower(pattern))
+}
+
+// matchAny 文本是否匹配任一关键词（空列表匹配全部）
+func (s patternSet) matchAny(text string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if s.match(text, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRuleEnv 根据消息构建规则求值环境（不含链接字段）
+func newRuleEnv(msg *tg.Message, channelID int64, text string) RuleEnv {
+	env := RuleEnv{
+		Text:      text,
+		ChannelID: channelID,
+	}
+	if msg.Media != nil {
+		_, empty := msg.Media.(*tg.MessageMediaEmpty)
+		env.HasMedia = !empty
+	}
+	if fwd, ok := msg.GetFwdFrom(); ok {
+		env.IsForward = true
+		if fromID, ok := fwd.GetFromID(); ok {
+			env.ForwardFrom = getPeerID(fromID)
+		}
+	}
+	return env
+}
+
+// linkHost 链接的主机名（小写）：节点使用解析出的服务器地址（vmess 的 base64、ss 的 userinfo 形式
+// 无法直接用 URL 解析），其余链接按 URL 解析
+func linkHost(link string) string {
+	if node, err := ParseProxyNode(link); err == nil {
+		return node.Server
+	}
+	if u, err := url.Parse(link); err == nil {
+		return strings.ToLower(u.Hostname())
+	}
+	return ""
+}
+
+// applyFilterRules 对链接逐个执行表达式规则，返回保留的链接
+func (p *MessageProcessor) applyFilterRules(rules []FilterRule, env RuleEnv, links []string, msgType string, msgID int) []string {
+	if len(rules) == 0 {
+		return links
+	}
+
+	hasKeepRules := false
+	for _, rule := range rules {
+		if rule.Action == "keep" {
+			hasKeepRules = true
+			break
+		}
+	}
+
+	var kept []string
+	for _, link := range links {
+		env.Link = link
+		env.Protocol = strings.ToLower(strings.SplitN(link, "://", 2)[0])
+		env.Host = linkHost(link)
+
+		dropped := ""
+		matchedKeep := false
+		for _, rule := range rules {
+			output, err := expr.Run(rule.program, env)
+			if err != nil {
+				fmt.Printf("⚠️  规则 %q 执行失败 (link=%.80s): %v\n", rule.Name, link, err)
+				continue
+			}
+			if matched, _ := output.(bool); matched {
+				if rule.Action == "drop" {
+					dropped = rule.Name
+					break
+				}
+				matchedKeep = true
+			}
+		}
+
+		switch {
+		case dropped != "":
+			fmt.Printf("🚫 %s链接被规则丢弃 (ID=%d, 规则=%s): %.80s\n", msgType, msgID, dropped, link)
+		case hasKeepRules && !matchedKeep:
+			fmt.Printf("🚫 %s链接未匹配任何 keep 规则 (ID=%d): %.80s\n", msgType, msgID, link)
+		default:
+			kept = append(kept, link)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,171 @@
+// tdl-msgproce - 正则与表达式过滤规则测试
+package main
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestMatchPatternRegex(t *testing.T) {
+	cfg := &Config{}
+	cfg.Monitor.Filters.LinkBlacklist = []string{`re:\.(jpe?g|png)$`, "register"}
+	cfg.Monitor.Filters.ContentFilter = []string{`re:免费\s*订阅`}
+	if err := compileFilterRules(cfg); err != nil {
+		t.Fatalf("compileFilterRules: %v", err)
+	}
+
+	tests := []struct {
+		text    string
+		pattern string
+		want    bool
+	}{
+		{"https://a.com/x.JPG", `re:\.(jpe?g|png)$`, true},      // 正则不区分大小写
+		{"https://a.com/x.jpg?v=1", `re:\.(jpe?g|png)$`, false}, // 锚定结尾
+		{"https://a.com/REGISTER", "register", true},            // 普通关键词按子串匹配
+		{"今日免费 订阅更新", `re:免费\s*订阅`, true},
+		{"今日订阅", `re:免费\s*订阅`, false},
+	}
+	for _, tt := range tests {
+		if got := cfg.patterns.match(tt.text, tt.pattern); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.text, tt.pattern, got, tt.want)
+		}
+	}
+
+	p := &MessageProcessor{config: cfg}
+	links := []string{"https://a.com/sub", "https://a.com/logo.png", "https://a.com/register?ref=1"}
+	got := p.FilterLinks(links, cfg.Monitor.Filters.LinkBlacklist)
+	if want := []string{"https://a.com/sub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterLinks = %v, want %v", got, want)
+	}
+
+	// 正则随配置保存：重新加载的配置不再使用旧配置的正则
+	reloaded := &Config{}
+	reloaded.Monitor.Filters.LinkBlacklist = []string{"register"}
+	if err := compileFilterRules(reloaded); err != nil {
+		t.Fatalf("compileFilterRules: %v", err)
+	}
+	if reloaded.patterns.match("https://a.com/x.png", `re:\.(jpe?g|png)$`) {
+		t.Errorf("重新加载的配置仍匹配旧配置的正则")
+	}
+}
+
+func TestCompileFilterRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(cfg *Config)
+		want  string
+	}{
+		{"subs 不支持正则", func(cfg *Config) { cfg.Monitor.Filters.Subs = []string{"re:https?://"} }, "subs / ss"},
+		{"ss 不支持正则", func(cfg *Config) { cfg.Monitor.Filters.SS = []string{"vmess://", "re:v(mess|less)://"} }, "subs / ss"},
+		{"无效正则", func(cfg *Config) { cfg.Monitor.Filters.LinkBlacklist = []string{"re:(unclosed"} }, "正则"},
+		{"无效表达式", func(cfg *Config) { cfg.Monitor.Filters.Rules = []FilterRule{{Expr: `host ==`}} }, "表达式无效"},
+		{"非布尔表达式", func(cfg *Config) { cfg.Monitor.Filters.Rules = []FilterRule{{Expr: `host`}} }, "表达式无效"},
+		{"未知字段", func(cfg *Config) { cfg.Monitor.Filters.Rules = []FilterRule{{Expr: `domain == "x"`}} }, "表达式无效"},
+		{"无效 action", func(cfg *Config) { cfg.Monitor.Filters.Rules = []FilterRule{{Expr: `true`, Action: "skip"}} }, "action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			tt.setup(cfg)
+			err := compileFilterRules(cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("compileFilterRules error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkHost(t *testing.T) {
+	vmessJSON := `{"v":"2","ps":"n","add":"VM.Example.com","port":"443","id":"b831381d-6324-4d53-ad4f-8cda48b30811","net":"ws"}`
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"vmess://" + base64.StdEncoding.EncodeToString([]byte(vmessJSON)), "vm.example.com"},
+		{"ss://" + base64.URLEncoding.EncodeToString([]byte("aes-256-gcm:pw")) + "@ss.example.com:8388#n", "ss.example.com"},
+		{"ss://" + base64.StdEncoding.EncodeToString([]byte("aes-256-gcm:pw@legacy.example.com:8388")) + "#n", "legacy.example.com"},
+		{"trojan://pw@[2001:db8::1]:443#v6", "2001:db8::1"},
+		{"https://Sub.Example.com/api?token=1", "sub.example.com"},
+	}
+	for _, tt := range tests {
+		if got := linkHost(tt.link); got != tt.want {
+			t.Errorf("linkHost(%.40q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestApplyFilterRules(t *testing.T) {
+	vmess := "vmess://" + base64.StdEncoding.EncodeToString([]byte(
+		`{"v":"2","ps":"n","add":"blocked.example.com","port":"443","id":"b831381d-6324-4d53-ad4f-8cda48b30811"}`))
+	trojan := "trojan://pw@ok.example.com:443#t"
+	sub := "https://t.me/share"
+	links := []string{vmess, trojan, sub}
+
+	tests := []struct {
+		name  string
+		rules []FilterRule
+		env   RuleEnv
+		want  []string
+	}{
+		{
+			name:  "按节点服务器丢弃",
+			rules: []FilterRule{{Expr: `host == "blocked.example.com"`}},
+			want:  []string{trojan, sub},
+		},
+		{
+			name:  "按主机后缀丢弃",
+			rules: []FilterRule{{Expr: `host == "t.me" || host endsWith ".t.me"`}},
+			want:  []string{vmess, trojan},
+		},
+		{
+			name:  "keep 只保留匹配的链接",
+			rules: []FilterRule{{Expr: `protocol in ["trojan", "vmess"]`, Action: "keep"}},
+			want:  []string{vmess, trojan},
+		},
+		{
+			name:  "drop 优先于 keep",
+			rules: []FilterRule{{Expr: `protocol == "trojan"`, Action: "keep"}, {Expr: `link contains "ok."`}},
+			want:  nil,
+		},
+		{
+			name:  "转发消息只收节点",
+			rules: []FilterRule{{Expr: `is_forward && protocol in ["https", "http"]`}},
+			env:   RuleEnv{IsForward: true},
+			want:  []string{vmess, trojan},
+		},
+		{
+			name:  "消息字段",
+			rules: []FilterRule{{Expr: `channel_id == 42 && text matches "(?i)广告"`}},
+			env:   RuleEnv{ChannelID: 42, Text: "这是广告"},
+			want:  nil,
+		},
+	}
+	p := &MessageProcessor{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := compileRules(tt.rules); err != nil {
+				t.Fatalf("compileRules: %v", err)
+			}
+			got := p.applyFilterRules(tt.rules, tt.env, links, "测试", 1)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyFilterRules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRuleEnv(t *testing.T) {
+	fwd := tg.MessageFwdHeader{}
+	fwd.SetFromID(&tg.PeerChannel{ChannelID: 777})
+	msg := &tg.Message{Message: "hi", Media: &tg.MessageMediaPhoto{}}
+	msg.SetFwdFrom(fwd)
+
+	env := newRuleEnv(msg, 42, "hi")
+	if !env.HasMedia || !env.IsForward || env.ForwardFrom != 777 || env.ChannelID != 42 {
+		t.Errorf("newRuleEnv = %+v", env)
+	}
+}
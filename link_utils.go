@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/gotd/td/tg"
 )
 
 // buildLinkRegex 根据配置构建链接提取的正则表达式
@@ -62,6 +64,69 @@ func (p *MessageProcessor) ExtractAllLinks(text string) []string {
 	return p.linkRegex.FindAllString(text, -1)
 }
 
+// extractHiddenURLs 提取消息中未直接显示在正文里的链接
+// 包括文本超链接实体（MessageEntityTextURL）和内联/回复键盘中的 URL 按钮
+func extractHiddenURLs(msg *tg.Message) []string {
+	var urls []string
+
+	if entities, ok := msg.GetEntities(); ok {
+		for _, entity := range entities {
+			if textURL, ok := entity.(*tg.MessageEntityTextURL); ok {
+				urls = append(urls, textURL.URL)
+			}
+		}
+	}
+
+	var rows []tg.KeyboardButtonRow
+	if markup, ok := msg.GetReplyMarkup(); ok {
+		switch m := markup.(type) {
+		case *tg.ReplyInlineMarkup:
+			rows = m.Rows
+		case *tg.ReplyKeyboardMarkup:
+			rows = m.Rows
+		}
+	}
+	for _, row := range rows {
+		for _, button := range row.Buttons {
+			switch b := button.(type) {
+			case *tg.KeyboardButtonURL:
+				urls = append(urls, b.URL)
+			case *tg.KeyboardButtonURLAuth:
+				urls = append(urls, b.URL)
+			}
+		}
+	}
+
+	return urls
+}
+
+// messageScanText 返回用于格式匹配和链接提取的完整文本（正文 + 隐藏链接，每个链接单独一行）
+func messageScanText(msg *tg.Message) string {
+	hidden := extractHiddenURLs(msg)
+	if len(hidden) == 0 {
+		return msg.Message
+	}
+	return msg.Message + "\n" + strings.Join(hidden, "\n")
+}
+
+// ExtractMessageLinks 从整条消息中提取链接（正文、文本超链接、URL 按钮），结果去重并保持顺序
+func (p *MessageProcessor) ExtractMessageLinks(msg *tg.Message) []string {
+	return uniqueLinks(p.ExtractAllLinks(messageScanText(msg)))
+}
+
+// uniqueLinks 链接去重，保持原有顺序
+func uniqueLinks(links []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, link := range links {
+		if !seen[link] {
+			seen[link] = true
+			result = append(result, link)
+		}
+	}
+	return result
+}
+
 // IsProxyNode 判断链接是否为代理节点链接（从配置文件读取协议列表）
 func (p *MessageProcessor) IsProxyNode(link string) bool {
 	linkLower := strings.ToLower(link)
@@ -75,13 +140,13 @@ func (p *MessageProcessor) IsProxyNode(link string) bool {
 	return false
 }
 
-// FilterLinks 过滤黑名单链接
+// FilterLinks 过滤黑名单链接（关键词支持 re: 前缀的正则表达式）
 func (p *MessageProcessor) FilterLinks(links []string, blacklist []string) []string {
 	var filtered []string
 	for _, link := range links {
 		blocked := false
 		for _, keyword := range blacklist {
-			if strings.Contains(strings.ToLower(link), strings.ToLower(keyword)) {
+			if p.config.patterns.match(link, keyword) {
 				blocked = true
 				break
 			}
@@ -9,13 +9,25 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gotd/td/tg"
 	"github.com/iyear/tdl/extension"
 )
 
 func main() {
+	// 离线回放 tdl chat export 导出文件（不连接 Telegram）
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplayCommand(os.Args[2:]); err != nil {
+			fmt.Printf("❌ 回放失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 1. 创建 dispatcher，它将作为所有更新事件的路由器
 	dispatcher := tg.NewUpdateDispatcher()
 
@@ -56,19 +68,179 @@ func run(ctx context.Context, ext *extension.Extension, dispatcher tg.UpdateDisp
 
 	// 创建处理器，并将功能完整的 client 传递进去
 	processor := &MessageProcessor{
-		ext:             ext,
-		config:          config,
-		api:             api,
-		client:          client, // 使用 tdl 为我们创建好的客户端
-		selfUserID:      self.ID,
-		messageCache:    NewMessageCache(20000),
-		channelPts:      make(map[int64]int), // 初始化 pts 状态
-		linkRegex:       buildLinkRegex(config), // 预编译链接提取正则
-		groupedMessages: make(map[int64][]int), // 初始化消息集合追踪
+		ext:               ext,
+		config:            config,
+		api:               api,
+		client:            client, // 使用 tdl 为我们创建好的客户端
+		selfUserID:        self.ID,
+		messageCache:      NewMessageCache(20000),
+		messageLinks:      NewMessageLinkStore(messageLinksCapacity),
+		peers:             NewPeerResolver(api),
+		nodeDedup:         NewNodeDedup(nodeFingerprintTTL),
+		stats:             NewChannelStatsTracker(),
+		subAPI:            NewSubscriptionClient(config.Monitor.SubscriptionAPI.AddURL, config.Monitor.SubscriptionAPI.ApiKey),
+		channelPts:        make(map[int64]int), // 初始化 pts 状态
+		channelLastMsgID:  make(map[int64]int),
+		historyResumeIDs:  make(map[int64]int),
+		channelCatchingUp: make(map[int64]bool),
+		linkRegex:         buildLinkRegex(config), // 预编译链接提取正则
+		groupedMessages:   make(map[int64][]int),  // 初始化消息集合追踪
+	}
+
+	// 加载持久化的消息去重缓存，避免重启后重复处理已处理过的消息
+	cachePath := filepath.Join(ext.Config().DataDir, "message_cache.json")
+	if n, err := processor.messageCache.Load(cachePath); err != nil {
+		fmt.Printf("⚠️  加载消息缓存失败: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("💾 已加载消息缓存: %d 条\n", n)
+	}
+	go processor.messageCache.StartAutoSave(ctx, cachePath, 1*time.Minute)
+	defer func() {
+		if err := processor.messageCache.Save(cachePath); err != nil {
+			fmt.Printf("⚠️  保存消息缓存失败: %v\n", err)
+		}
+	}()
+
+	// 加载每条消息提取过的链接，重启后编辑消息仍只提交新增链接
+	linksPath := filepath.Join(ext.Config().DataDir, "message_links.json")
+	if n, err := processor.messageLinks.Load(linksPath); err != nil {
+		fmt.Printf("⚠️  加载消息链接记录失败: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("💾 已加载消息链接记录: %d 条\n", n)
+	}
+	go processor.messageLinks.StartAutoSave(ctx, linksPath, 1*time.Minute)
+	defer func() {
+		if err := processor.messageLinks.Save(linksPath); err != nil {
+			fmt.Printf("⚠️  保存消息链接记录失败: %v\n", err)
+		}
+	}()
+
+	// 加载对等体缓存（AccessHash），所有子系统共用
+	peerCachePath := filepath.Join(ext.Config().DataDir, "peer_cache.json")
+	if n, err := processor.peers.Load(peerCachePath); err != nil {
+		fmt.Printf("⚠️  加载对等体缓存失败: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("💾 已加载对等体缓存: %d 个\n", n)
+	}
+	go processor.peers.StartAutoSave(ctx, peerCachePath, 1*time.Minute)
+	defer func() {
+		if err := processor.peers.Save(peerCachePath); err != nil {
+			fmt.Printf("⚠️  保存对等体缓存失败: %v\n", err)
+		}
+	}()
+
+	// 加载已提交节点的指纹缓存，避免重启后重复提交同一服务器
+	nodeDedupPath := filepath.Join(ext.Config().DataDir, "node_fingerprints.json")
+	if n, err := processor.nodeDedup.Load(nodeDedupPath); err != nil {
+		fmt.Printf("⚠️  加载节点指纹缓存失败: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("💾 已加载节点指纹缓存: %d 个\n", n)
+	}
+	go processor.nodeDedup.StartAutoSave(ctx, nodeDedupPath, 1*time.Minute)
+	defer func() {
+		if err := processor.nodeDedup.Save(nodeDedupPath); err != nil {
+			fmt.Printf("⚠️  保存节点指纹缓存失败: %v\n", err)
+		}
+	}()
+
+	// 加载频道同步状态（pts），用于补偿停机或断线期间漏掉的消息
+	if err := processor.loadChannelState(filepath.Join(ext.Config().DataDir, "channel_state.json")); err != nil {
+		fmt.Printf("⚠️  加载频道同步状态失败: %v\n", err)
+	}
+	go processor.StartChannelStateAutoSave(ctx, 1*time.Minute)
+	defer func() {
+		if err := processor.saveChannelState(); err != nil {
+			fmt.Printf("⚠️  保存频道同步状态失败: %v\n", err)
+		}
+	}()
+
+	// 创建输出目标（订阅 API 及 monitor.sinks 中启用的输出）
+	processor.sinks = NewSinkRegistry(processor, ext.Config().DataDir)
+	fmt.Printf("📤 输出目标: %s\n", strings.Join(processor.sinks.Names(), ", "))
+	go processor.sinks.StartCollectionPruner(ctx, collectionPruneInterval)
+
+	// 演练模式：决策记录写入 DataDir/dry_run.jsonl，不提交到任何输出目标（在流水线排空后关闭）
+	if config.Monitor.DryRun {
+		dryRunPath := filepath.Join(ext.Config().DataDir, "dry_run.jsonl")
+		dryRun, err := NewDryRunRecorder(dryRunPath)
+		if err != nil {
+			return fmt.Errorf("打开演练记录文件失败: %w", err)
+		}
+		processor.dryRun = dryRun
+		fmt.Printf("🧪 演练模式已启用，决策记录写入 %s（不会提交任何链接）\n", dryRunPath)
+		defer func() {
+			fmt.Printf("🧪 演练结束: 本次写入 %d 条决策记录\n", dryRun.Count())
+			dryRun.Close()
+		}()
+	}
+
+	// 加载发件箱（订阅 API 不可用时保存的失败提交），后台定期重试
+	processor.outbox = NewOutbox(filepath.Join(ext.Config().DataDir, "outbox.json"))
+	if n, err := processor.outbox.Load(); err != nil {
+		fmt.Printf("⚠️  加载发件箱失败: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("📮 已加载发件箱: %d 条待重试\n", n)
+		processor.claimOutboxNodes(processor.outbox.snapshot()...)
+	}
+	if !config.Monitor.DryRun {
+		go processor.StartOutboxRetrier(ctx, outboxRetryInterval)
 	}
 
-	// 5. 调用新方法，将所有的消息处理逻辑注册到 dispatcher 中
-	processor.RegisterHandlers(dispatcher)
+	// 跨消息节点批量提交：退出时在流水线排空之后再提交剩余批次（见 drainPipeline）
+	if config.Monitor.Batching.Enabled {
+		processor.batcher = NewNodeBatcher(processor,
+			time.Duration(config.Monitor.Batching.Window)*time.Second, config.Monitor.Batching.MaxNodes)
+		fmt.Printf("📦 节点批量提交已启用 (窗口=%v, 最大节点数=%d)\n", processor.batcher.window, processor.batcher.maxNodes)
+	}
+
+	// 订阅流量记录：监听、Bot 和代理服务处理过的订阅的 Subscription-Userinfo，已失效的订阅不再提交
+	processor.subRegistry = NewSubscriptionRegistry(filepath.Join(ext.Config().DataDir, "subscriptions.json"))
+	if n, err := processor.subRegistry.Load(); err != nil {
+		fmt.Printf("⚠️  加载订阅记录失败: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("🧾 已加载订阅记录: %d 条\n", n)
+	}
+	go processor.subRegistry.StartAutoSave(ctx, 1*time.Minute)
+	defer func() {
+		if err := processor.subRegistry.Save(); err != nil {
+			fmt.Printf("⚠️  保存订阅记录失败: %v\n", err)
+		}
+	}()
+	processor.subRecheck = defaultSubRecheckInterval
+	if hours := config.Monitor.Features.SubscriptionInfo.RecheckHours; hours > 0 {
+		processor.subRecheck = time.Duration(hours) * time.Hour
+	}
+
+	// 订阅预检：提交前下载订阅识别格式，跳过登录页、图片等无效链接
+	check := config.Monitor.Features.SubscriptionCheck
+	if check.Enabled || config.Monitor.Features.SubscriptionInfo.Enabled {
+		processor.subChecker = NewSubscriptionChecker(time.Duration(check.Timeout)*time.Second, check.MaxSizeKB)
+	}
+	if check.Enabled {
+		fmt.Printf("🔍 订阅预检已启用\n")
+	}
+	if config.Monitor.Features.SubscriptionInfo.Enabled {
+		fmt.Printf("🧾 订阅流量记录已启用 (失效订阅复查间隔=%v)\n", processor.subRecheck)
+	}
+
+	// 节点本地探测：在批量提交前过滤不可达的节点
+	if probe := config.Monitor.Features.NodeProbe; probe.Enabled {
+		processor.prober = NewNodeProber(time.Duration(probe.Timeout)*time.Second, probe.Concurrency)
+		fmt.Printf("📡 节点本地探测已启用 (超时=%v, 并发=%d)\n", processor.prober.timeout, processor.prober.concurrency)
+	}
+
+	// 启动异步消息处理流水线，退出时先排空队列和节点批次再保存各项缓存
+	// 监听器在停止客户端前排空；这里等待排空完成（监听未启用时由这里排空）
+	processor.pipeline = NewMessagePipeline(config.Monitor.Pipeline.Workers, config.Monitor.Pipeline.QueueSize, processor.processQueuedMessage)
+	defer processor.drainPipeline()
+
+	// 解析配置中的频道和签到机器人（支持 @username、t.me 链接和邀请链接）
+	processor.resolveConfiguredPeers(ctx)
+
+	// 5. 调用新方法，将所有的消息处理逻辑注册到 dispatcher 中（仅在启用监听时）
+	if config.Monitor.Enabled {
+		processor.RegisterHandlers(dispatcher)
+	}
 
 	// 启动后台服务
 	errChan := make(chan error, 4)
@@ -94,6 +266,7 @@ func run(ctx context.Context, ext *extension.Extension, dispatcher tg.UpdateDisp
 		fmt.Printf("🔄 启动 HTTP 代理服务... (地址: %s:%d)\n", config.Proxy.Host, config.Proxy.Port)
 		activeServices++
 		proxyServer := NewProxyServer(&config.Proxy)
+		proxyServer.subRegistry = processor.subRegistry
 		go func() {
 			errChan <- proxyServer.Start(ctx)
 		}()
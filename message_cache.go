@@ -1,4 +1,4 @@
-// tdl-msgproce - 消息缓存管理（LRU算法）
+// tdl-msgproce - 消息缓存管理（LRU算法，支持磁盘持久化）
 // 
 // 日志输出规范：
 // - 使用 fmt.Printf() 输出用户可见的日志信息
@@ -8,8 +8,10 @@ package main
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"sync"
+	"time"
 )
 
 // MessageCache LRU 缓存，用于消息去重
@@ -18,6 +20,7 @@ type MessageCache struct {
 	capacity int
 	cache    map[string]*list.Element // 键格式: "channelID_messageID"
 	lru      *list.List               // 双向链表，记录顺序
+	dirty    bool                     // 自上次保存后是否有变更
 }
 
 // cacheEntry 缓存条目
@@ -27,6 +30,13 @@ type cacheEntry struct {
 	editDate  int   // 编辑时间戳，0 表示未编辑
 }
 
+// persistedCacheEntry 持久化到磁盘的缓存条目
+type persistedCacheEntry struct {
+	ChannelID int64 `json:"channel_id"`
+	MessageID int   `json:"message_id"`
+	EditDate  int   `json:"edit_date"`
+}
+
 // NewMessageCache 创建一个新的消息缓存
 func NewMessageCache(capacity int) *MessageCache {
 	return &MessageCache{
@@ -63,6 +73,7 @@ func (mc *MessageCache) Add(channelID int64, messageID int, editDate int) {
 		mc.lru.MoveToFront(elem)
 		// 更新编辑时间
 		elem.Value.(*cacheEntry).editDate = editDate
+		mc.dirty = true
 		return
 	}
 
@@ -85,6 +96,7 @@ func (mc *MessageCache) Add(channelID int64, messageID int, editDate int) {
 	}
 	elem := mc.lru.PushFront(entry)
 	mc.cache[key] = elem
+	mc.dirty = true
 }
 
 // AddOrUpdate 添加或更新消息，返回是否为编辑更新（内容有变化）
@@ -105,6 +117,7 @@ func (mc *MessageCache) AddOrUpdate(channelID int64, messageID int, editDate int
 			// 编辑时间更新，需要重新处理
 			oldEntry.editDate = editDate
 			mc.lru.MoveToFront(elem)
+			mc.dirty = true
 			return true, true
 		}
 		// 编辑时间未变，可能是重复事件
@@ -130,6 +143,7 @@ func (mc *MessageCache) AddOrUpdate(channelID int64, messageID int, editDate int
 	}
 	elem := mc.lru.PushFront(entry)
 	mc.cache[key] = elem
+	mc.dirty = true
 
 	// 新消息，需要处理
 	return false, true
@@ -141,3 +155,87 @@ func (mc *MessageCache) Len() int {
 	defer mc.mu.RUnlock()
 	return mc.lru.Len()
 }
+
+// Load 从磁盘加载缓存（按从旧到新的顺序恢复），返回加载的条目数
+// 文件不存在时视为空缓存
+func (mc *MessageCache) Load(filename string) (int, error) {
+	var entries []persistedCacheEntry
+	found, err := loadJSONFile(filename, &entries)
+	if err != nil || !found {
+		return 0, err
+	}
+
+	// 只保留最新的 capacity 条
+	if len(entries) > mc.capacity {
+		entries = entries[len(entries)-mc.capacity:]
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for _, e := range entries {
+		key := GetCacheKey(e.ChannelID, e.MessageID)
+		if elem, exists := mc.cache[key]; exists {
+			elem.Value.(*cacheEntry).editDate = e.EditDate
+			mc.lru.MoveToFront(elem)
+			continue
+		}
+		elem := mc.lru.PushFront(&cacheEntry{
+			channelID: e.ChannelID,
+			messageID: e.MessageID,
+			editDate:  e.EditDate,
+		})
+		mc.cache[key] = elem
+	}
+
+	return len(entries), nil
+}
+
+// Save 将缓存写入磁盘（从旧到新排列），无变更时跳过
+func (mc *MessageCache) Save(filename string) error {
+	mc.mu.Lock()
+	if !mc.dirty {
+		mc.mu.Unlock()
+		return nil
+	}
+	entries := make([]persistedCacheEntry, 0, mc.lru.Len())
+	for elem := mc.lru.Back(); elem != nil; elem = elem.Prev() {
+		e := elem.Value.(*cacheEntry)
+		entries = append(entries, persistedCacheEntry{
+			ChannelID: e.channelID,
+			MessageID: e.messageID,
+			EditDate:  e.editDate,
+		})
+	}
+	mc.dirty = false
+	mc.mu.Unlock()
+
+	if err := saveJSONFile(filename, entries); err != nil {
+		// 保存失败，恢复脏标记以便下次重试
+		mc.mu.Lock()
+		mc.dirty = true
+		mc.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// StartAutoSave 定期将缓存写入磁盘，ctx 结束时执行最后一次保存
+func (mc *MessageCache) StartAutoSave(ctx context.Context, filename string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := mc.Save(filename); err != nil {
+				fmt.Printf("⚠️  保存消息缓存失败: %v\n", err)
+			}
+			return
+		case <-ticker.C:
+			if err := mc.Save(filename); err != nil {
+				fmt.Printf("⚠️  保存消息缓存失败: %v\n", err)
+			}
+		}
+	}
+}
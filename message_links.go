@@ -0,0 +1,217 @@
+// tdl-msgproce - 消息链接记录（编辑消息只提交新增链接）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const messageLinksCapacity = 20000 // 最多记录的消息数（与消息缓存一致）
+
+// messageLinkEntry 一条消息通过过滤的链接集合
+type messageLinkEntry struct {
+	ChannelID int64    `json:"channel_id"`
+	MessageID int      `json:"message_id"`
+	Links     []string `json:"links"`
+}
+
+// MessageLinkStore 按消息记录上次通过过滤的链接（LRU，持久化到磁盘）
+// 编辑消息时与新提取的链接对比，只提交新增的链接
+type MessageLinkStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element // 键格式: "channelID_messageID"
+	lru      *list.List
+	dirty    bool
+}
+
+// NewMessageLinkStore 创建消息链接记录
+func NewMessageLinkStore(capacity int) *MessageLinkStore {
+	return &MessageLinkStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Get 返回消息上次记录的链接
+func (s *MessageLinkStore) Get(channelID int64, messageID int) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[GetCacheKey(channelID, messageID)]
+	if !ok {
+		return nil, false
+	}
+	return append([]string(nil), elem.Value.(*messageLinkEntry).Links...), true
+}
+
+// Put 记录消息的链接集合，links 为空时删除记录（只保存包含链接的消息）
+func (s *MessageLinkStore) Put(channelID int64, messageID int, links []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := GetCacheKey(channelID, messageID)
+	if elem, ok := s.entries[key]; ok {
+		if len(links) == 0 {
+			s.lru.Remove(elem)
+			delete(s.entries, key)
+		} else {
+			elem.Value.(*messageLinkEntry).Links = append([]string(nil), links...)
+			s.lru.MoveToFront(elem)
+		}
+		s.dirty = true
+		return
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	s.entries[key] = s.lru.PushFront(&messageLinkEntry{
+		ChannelID: channelID,
+		MessageID: messageID,
+		Links:     append([]string(nil), links...),
+	})
+	for s.lru.Len() > s.capacity {
+		oldest := s.lru.Back()
+		e := oldest.Value.(*messageLinkEntry)
+		delete(s.entries, GetCacheKey(e.ChannelID, e.MessageID))
+		s.lru.Remove(oldest)
+	}
+	s.dirty = true
+}
+
+// Len 返回记录的消息数量
+func (s *MessageLinkStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// Load 从磁盘加载记录（按从旧到新的顺序恢复），返回加载的条目数
+func (s *MessageLinkStore) Load(filename string) (int, error) {
+	var entries []messageLinkEntry
+	found, err := loadJSONFile(filename, &entries)
+	if err != nil || !found {
+		return 0, err
+	}
+	if len(entries) > s.capacity {
+		entries = entries[len(entries)-s.capacity:]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range entries {
+		e := entries[i]
+		key := GetCacheKey(e.ChannelID, e.MessageID)
+		if elem, ok := s.entries[key]; ok {
+			s.lru.Remove(elem)
+		}
+		s.entries[key] = s.lru.PushFront(&e)
+	}
+	return len(entries), nil
+}
+
+// Save 将记录写入磁盘（从旧到新排列），无变更时跳过
+func (s *MessageLinkStore) Save(filename string) error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	entries := make([]messageLinkEntry, 0, s.lru.Len())
+	for elem := s.lru.Back(); elem != nil; elem = elem.Prev() {
+		entries = append(entries, *elem.Value.(*messageLinkEntry))
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	if err := saveJSONFile(filename, entries); err != nil {
+		// 保存失败，恢复脏标记以便下次重试
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// StartAutoSave 定期将记录写入磁盘，ctx 结束时执行最后一次保存
+func (s *MessageLinkStore) StartAutoSave(ctx context.Context, filename string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Save(filename); err != nil {
+				fmt.Printf("⚠️  保存消息链接记录失败: %v\n", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.Save(filename); err != nil {
+				fmt.Printf("⚠️  保存消息链接记录失败: %v\n", err)
+			}
+		}
+	}
+}
+
+// diffLinks 对比两次提取的链接，返回 (新增的链接, 移除的链接)，保持原有顺序
+func diffLinks(previous, current []string) ([]string, []string) {
+	before := make(map[string]bool, len(previous))
+	for _, link := range previous {
+		before[link] = true
+	}
+	after := make(map[string]bool, len(current))
+	var added []string
+	for _, link := range current {
+		after[link] = true
+		if !before[link] {
+			added = append(added, link)
+		}
+	}
+	var removed []string
+	for _, link := range previous {
+		if !after[link] {
+			removed = append(removed, link)
+		}
+	}
+	return added, removed
+}
+
+// updateMessageLinks 消息处理结束时记录通过过滤的链接；编辑后被移除的链接输出日志，
+// 启用 edit_retract 时通知支持撤回的输出目标
+func (p *MessageProcessor) updateMessageLinks(ctx context.Context, channelID int64, msgID int, previous []string, current []string, rec *DryRunRecord, msgTypeLabel string) {
+	_, removed := diffLinks(previous, current)
+	if len(removed) > 0 {
+		fmt.Printf("🗑️  %s移除了 %d 个链接 (ID=%d, 频道: %d)\n", msgTypeLabel, len(removed), msgID, channelID)
+		for _, link := range removed {
+			fmt.Printf("   - %.80s\n", link)
+		}
+		if rec != nil {
+			rec.Removed = removed
+		}
+	}
+
+	if p.dryRun != nil {
+		// 离线回放使用独立的记录；实时演练不修改持久化的链接记录，也不撤回
+		if p.dryRun.file == nil {
+			p.messageLinks.Put(channelID, msgID, current)
+		}
+		return
+	}
+	p.messageLinks.Put(channelID, msgID, current)
+
+	if len(removed) > 0 && p.config.Monitor.Features.EditRetract {
+		p.retractFromSinks(ctx, p.sinks.ForRules(p.channelRules(channelID)), removed, msgTypeLabel)
+	}
+}
@@ -0,0 +1,109 @@
+// tdl-msgproce - 消息链接记录测试
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+// newTestReplayProcessor 加载测试配置，创建离线回放用的处理器（演练模式，决策写入内存）
+func newTestReplayProcessor(t *testing.T) *MessageProcessor {
+	t.Helper()
+	config, err := loadConfig("testdata/replay_config.yaml")
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	p := &MessageProcessor{
+		config:    config,
+		linkRegex: buildLinkRegex(config),
+		subAPI:    NewSubscriptionClient(config.Monitor.SubscriptionAPI.AddURL, config.Monitor.SubscriptionAPI.ApiKey),
+	}
+	p.sinks = NewSinkRegistry(p, t.TempDir())
+	return p.newReplayProcessor()
+}
+
+func TestDiffLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []string
+		current  []string
+		added    []string
+		removed  []string
+	}{
+		{"首次处理", nil, []string{"a", "b"}, []string{"a", "b"}, nil},
+		{"没有变化", []string{"a", "b"}, []string{"b", "a"}, nil, nil},
+		{"新增和移除", []string{"a", "b", "c"}, []string{"d", "b", "e"}, []string{"d", "e"}, []string{"a", "c"}},
+		{"全部移除", []string{"a", "b"}, nil, nil, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := diffLinks(tt.previous, tt.current)
+			if !reflect.DeepEqual(added, tt.added) || !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("diffLinks = (%v, %v), want (%v, %v)", added, removed, tt.added, tt.removed)
+			}
+		})
+	}
+}
+
+func TestProcessEditedMessage(t *testing.T) {
+	const channelID, msgID = 1001, 10
+	nodeA := "trojan://pw@a.example.com:443#A"
+	nodeB := "trojan://pw@b.example.com:443#B"
+	nodeC := "trojan://pw@c.example.com:443#C"
+	nodeD := "trojan://pw@d.example.com:443#D"
+
+	p := newTestReplayProcessor(t)
+	process := func(text string, edited bool) *DryRunRecord {
+		t.Helper()
+		msg := &tg.Message{ID: msgID, Message: text}
+		if _, _, err := p.processMessageContent(context.Background(), msg, channelID, edited); err != nil {
+			t.Fatalf("processMessageContent: %v", err)
+		}
+		records := p.dryRun.Records()
+		return records[len(records)-1]
+	}
+	links := func(rec *DryRunRecord) []string {
+		var out []string
+		for _, l := range rec.Links {
+			out = append(out, l.Link)
+		}
+		return out
+	}
+
+	steps := []struct {
+		name      string
+		text      string
+		edited    bool
+		decision  string
+		skippedBy string
+		links     []string
+		removed   []string
+		stored    []string
+	}{
+		{"新消息", nodeA + "\n" + nodeB, false, "submit", "", []string{nodeA, nodeB}, nil, []string{nodeA, nodeB}},
+		{"编辑后只提交新增链接", nodeB + "\n" + nodeC, true, "submit", "", []string{nodeC}, []string{nodeA}, []string{nodeB, nodeC}},
+		{"链接未变化", nodeC + "\n" + nodeB, true, "skip", dryRunStageEdit, nil, nil, []string{nodeC, nodeB}},
+		// 提取完成前跳过：保留上次的记录，不视为移除
+		{"编辑为不含链接的文本", "节点维护中", true, "skip", dryRunStageFormat, nil, nil, []string{nodeC, nodeB}},
+		{"编辑为黑名单链接", "订阅 https://t.me/share", true, "skip", dryRunStageBlack, nil, nil, []string{nodeC, nodeB}},
+		{"恢复后只提交新增链接", nodeB + "\n" + nodeC + "\n" + nodeD, true, "submit", "", []string{nodeD}, nil, []string{nodeB, nodeC, nodeD}},
+	}
+	for _, step := range steps {
+		rec := process(step.text, step.edited)
+		if rec.Decision != step.decision || rec.SkippedBy != step.skippedBy {
+			t.Errorf("%s: decision = %s/%s, want %s/%s", step.name, rec.Decision, rec.SkippedBy, step.decision, step.skippedBy)
+		}
+		if got := links(rec); !reflect.DeepEqual(got, step.links) {
+			t.Errorf("%s: links = %v, want %v", step.name, got, step.links)
+		}
+		if !reflect.DeepEqual(rec.Removed, step.removed) {
+			t.Errorf("%s: removed = %v, want %v", step.name, rec.Removed, step.removed)
+		}
+		if stored, _ := p.messageLinks.Get(channelID, msgID); !reflect.DeepEqual(stored, step.stored) {
+			t.Errorf("%s: 记录的链接 = %v, want %v", step.name, stored, step.stored)
+		}
+	}
+}
@@ -7,36 +7,48 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gotd/td/tg"
 )
 
-// SubscriptionResponse 订阅API响应结构
-type SubscriptionResponse struct {
-	Message     string `json:"message"`
-	Error       string `json:"error"`
-	SubURL      string `json:"sub_url"`
-	TestedNodes *int   `json:"tested_nodes,omitempty"`
-	PassedNodes *int   `json:"passed_nodes,omitempty"`
-	FailedNodes *int   `json:"failed_nodes,omitempty"`
-	AddedNodes  *int   `json:"added_nodes,omitempty"`
-	Duration    string `json:"duration,omitempty"`
-	Timeout     *bool  `json:"timeout,omitempty"`
-	Warning     string `json:"warning,omitempty"`
+// isMonitoredPeer 检查是否是监听的频道（为 forward_target 添加例外），监听未启用时不处理任何会话
+// telegram 输出目标发送链接的会话不监听，避免循环提交
+func (p *MessageProcessor) isMonitoredPeer(peerID int64) bool {
+	if !p.config.Monitor.Enabled || (p.sinks != nil && p.sinks.TargetsChat(peerID)) {
+		return false
+	}
+	return contains(p.config.Monitor.Channels, peerID) || (p.config.Monitor.Features.AutoRecloneForwards && peerID == p.config.Bot.ForwardTarget)
+}
+
+// isOwnMessage 检查是否为本账号发出的消息（Bot 回复、转发、输出目标发送的链接等），避免重复处理
+// forward_target 中待自动克隆的转发消息除外
+func (p *MessageProcessor) isOwnMessage(msg *tg.Message, peerID int64) bool {
+	if !msg.Out {
+		from, ok := msg.GetFromID()
+		user, isUser := from.(*tg.PeerUser)
+		if !ok || !isUser || user.UserID != p.selfUserID {
+			return false
+		}
+	}
+	_, forwarded := msg.GetFwdFrom()
+	return !(forwarded && p.config.Monitor.Features.AutoRecloneForwards && peerID == p.config.Bot.ForwardTarget)
 }
 
 // handleMessage 处理新消息（非编辑），返回 (有效订阅数, 有效节点数, error)
 func (p *MessageProcessor) handleMessage(ctx context.Context, msg *tg.Message, entities tg.Entities) (int, int, error) {
 	peerID := getPeerID(msg.PeerID)
 
+	// 先检查是否是监听的会话，未监听的私聊和群组消息以及本账号发出的消息不写入消息缓存
+	if !p.isMonitoredPeer(peerID) || p.isOwnMessage(msg, peerID) {
+		return 0, 0, nil
+	}
+
 	// 获取编辑时间（如果有）
 	editDate := 0
 	if date, ok := msg.GetEditDate(); ok {
@@ -58,27 +70,30 @@ func (p *MessageProcessor) handleMessage(ctx context.Context, msg *tg.Message, e
 		fmt.Printf("⚠️  通过新消息事件收到编辑消息 (message_id=%d, channel_id=%d)\n", msg.ID, peerID)
 	}
 
-	// 检查是否是监听的频道（为 forward_target 添加例外）
-	if len(p.config.Monitor.Channels) > 0 {
-		if !contains(p.config.Monitor.Channels, peerID) && !(p.config.Monitor.Features.AutoRecloneForwards && peerID == p.config.Bot.ForwardTarget) {
-			return 0, 0, nil
-		}
-	}
-
 	// 打印调试日志
 	// fmt.Printf("[DEBUG] 处理新消息 (id=%d, channel_id=%d, content=%.50s)\n", msg.ID, peerID, msg.Message)
 	fmt.Printf("📨 收到新消息: ID=%d, 频道=%d, 内容=\"%.50s...\"\n", msg.ID, peerID, msg.Message)
 
-	p.messageCount++
+	atomic.AddInt64(&p.messageCount, 1)
 
 	// 调用通用的消息处理逻辑
-	return p.processMessageContent(ctx, msg, peerID, false)
+	subsCount, nodeCount, err := p.processMessageContent(ctx, msg, peerID, false)
+
+	// 更新频道高水位，下次启动时历史消息从此处续取
+	p.setChannelLastMessageID(peerID, msg.ID)
+
+	return subsCount, nodeCount, err
 }
 
 // handleEditMessage 处理编辑的消息，返回 (有效订阅数, 有效节点数, error)
 func (p *MessageProcessor) handleEditMessage(ctx context.Context, msg *tg.Message, entities tg.Entities) (int, int, error) {
 	peerID := getPeerID(msg.PeerID)
 
+	// 先检查是否是监听的会话，未监听的私聊和群组消息以及本账号发出的消息不写入消息缓存
+	if !p.isMonitoredPeer(peerID) || p.isOwnMessage(msg, peerID) {
+		return 0, 0, nil
+	}
+
 	// 获取编辑时间
 	editDate := 0
 	if date, ok := msg.GetEditDate(); ok {
@@ -94,20 +109,13 @@ func (p *MessageProcessor) handleEditMessage(ctx context.Context, msg *tg.Messag
 		return 0, 0, nil
 	}
 
-	// 检查是否是监听的频道（为 forward_target 添加例外）
-	if len(p.config.Monitor.Channels) > 0 {
-		if !contains(p.config.Monitor.Channels, peerID) && !(p.config.Monitor.Features.AutoRecloneForwards && peerID == p.config.Bot.ForwardTarget) {
-			return 0, 0, nil
-		}
-	}
-
 	// 打印调试日志
 	_ = isEdit
 	// fmt.Printf("[DEBUG] 处理编辑消息 (id=%d, channel_id=%d, edit_date=%d, content=%.50s)\n", msg.ID, peerID, editDate, msg.Message)
 	fmt.Printf("📨 收到新消息[编辑]: ID=%d, 频道=%d, 内容=\"%.50s...\"\n",
 		msg.ID, peerID, msg.Message)
 
-	p.editedMsgCount++
+	atomic.AddInt64(&p.editedMsgCount, 1)
 
 	// 调用通用的消息处理逻辑
 	return p.processMessageContent(ctx, msg, peerID, true)
@@ -120,11 +128,31 @@ func (p *MessageProcessor) processMessageContent(ctx context.Context, msg *tg.Me
 		msgType = "编辑消息"
 	}
 
+	p.stats.Update(peerID, func(s *ChannelStats) { s.Messages++ })
+
+	// 演练模式：记录每个过滤阶段的决策，处理结束时写入决策记录
+	rec := p.newDryRunRecord(peerID, msg, isEdited)
+	defer p.writeDryRunRecord(rec)
+
+	// 记录本条消息通过过滤的链接：编辑消息只提交新增的链接，并处理编辑后被移除的链接
+	// 链接提取完成前跳过（空消息、格式或过滤未通过等）时保留上次的记录，不视为移除
+	var previousLinks, currentLinks []string
+	hasPrevious, extracted := false, false
+	if isEdited {
+		previousLinks, hasPrevious = p.messageLinks.Get(peerID, msg.ID)
+	}
+	defer func() {
+		if extracted {
+			p.updateMessageLinks(ctx, peerID, msg.ID, previousLinks, currentLinks, rec, msgType)
+		}
+	}()
+
 	// 【新功能】检查是否为 forward_target 频道的转发消息，自动克隆去除转发头
 	// 如果是 forward_target 频道，输出完整的原始消息结构
 	// fmt.Printf("📋 forward_target 频道收到消息 (message_id=%d): %+v\n", msg.ID, msg)
 
-	if p.config.Monitor.Features.AutoRecloneForwards && peerID == p.config.Bot.ForwardTarget {
+	// 演练模式不克隆转发消息
+	if p.config.Monitor.Features.AutoRecloneForwards && peerID == p.config.Bot.ForwardTarget && p.dryRun == nil {
 		fwdInfo, hasFwdFrom := msg.GetFwdFrom()
 		if hasFwdFrom {
 			// 检查是否为消息集合（Media Group/Album）
@@ -185,54 +213,130 @@ func (p *MessageProcessor) processMessageContent(ctx context.Context, msg *tg.Me
 		}
 	}
 
-	// 获取消息文本
-	text := msg.Message
+	// 获取消息文本（包含文本超链接和 URL 按钮中的隐藏链接）
+	text := messageScanText(msg)
+
+	// 附加文档附件内容（txt / Clash YAML / sing-box JSON）
+	extraText := p.scanMessageDocument(ctx, msg, peerID)
+
+	// 附加正文和代码块中 base64 节点包的解码结果（视为同一条消息的内容）
+	if bundleText := p.decodeMessageBundles(msg); bundleText != "" {
+		fmt.Printf("🔓 %s解码 base64 节点包: %d 个链接 (ID=%d, 频道=%d)\n", msgType, len(p.ExtractAllLinks(bundleText)), msg.ID, peerID)
+		extraText = strings.TrimPrefix(extraText+"\n"+bundleText, "\n")
+	}
+
+	if extraText != "" {
+		text = strings.TrimPrefix(text+"\n"+extraText, "\n")
+	}
+
 	if text == "" {
 		fmt.Printf("⏭️  %s跳过: 空消息 (ID=%d)\n", msgType, msg.ID)
+		rec.skip(dryRunStageEmpty)
 		return 0, 0, nil
 	}
 
+	// 频道生效的规则集（全局配置 + 频道级覆盖）
+	rules := p.channelRules(peerID)
+	if rec != nil {
+		rec.Rules = rules.Summary()
+	}
+
 	// 检查是否包含订阅格式或节点格式
-	hasSubsFormat := matchAny(text, p.config.Monitor.Filters.Subs)
-	hasNodeFormat := matchAny(text, p.config.Monitor.Filters.SS)
+	hasSubsFormat := rules.HasSubsFormat(text)
+	hasNodeFormat := rules.HasNodeFormat(text)
 
 	if !hasSubsFormat && !hasNodeFormat {
-		fmt.Printf("⏭️  %s跳过: 不包含订阅/节点格式 (ID=%d)\n", msgType, msg.ID)
+		fmt.Printf("⏭️  %s跳过: 不包含订阅/节点格式 (ID=%d, 规则=%s)\n", msgType, msg.ID, rules.Summary())
+		rec.skip(dryRunStageFormat)
 		return 0, 0, nil // 既不是订阅也不是节点，跳过
 	}
+	rec.pass(dryRunStageFormat)
 
-	// 白名单频道跳过二次过滤
-	isWhitelisted := contains(p.config.Monitor.WhitelistChannels, peerID)
-
-	// 仅对订阅格式进行二次内容过滤（节点格式不进行二次过滤）
+	// 仅对订阅格式进行二次内容过滤（节点格式不进行二次过滤），白名单频道跳过二次过滤
 	if hasSubsFormat && !hasNodeFormat {
 		// 纯订阅格式，需要二次过滤
-		if !isWhitelisted && len(p.config.Monitor.Filters.ContentFilter) > 0 {
-			if !matchAny(text, p.config.Monitor.Filters.ContentFilter) {
-				fmt.Printf("⏭️  %s跳过: 未通过内容二次过滤 (ID=%d)\n", msgType, msg.ID)
+		if !rules.Whitelisted && len(rules.ContentFilter) > 0 {
+			if !rules.patterns.matchAny(text, rules.ContentFilter) {
+				fmt.Printf("⏭️  %s跳过: 未通过内容二次过滤 (ID=%d, 规则=%s)\n", msgType, msg.ID, rules.Summary())
+				rec.skip(dryRunStageContent)
 				return 0, 0, nil
 			}
+			rec.pass(dryRunStageContent)
 		}
 	}
 	// 如果是节点格式（hasNodeFormat为true），则跳过二次过滤
 
 	// 提取链接
-	links := p.ExtractAllLinks(text)
+	links := p.ExtractMessageLinks(msg)
+	if extraText != "" {
+		links = uniqueLinks(append(links, p.ExtractAllLinks(extraText)...))
+	}
 	if len(links) == 0 {
-		fmt.Printf("⏭️  %s跳过: 未提取到有效链接 (ID=%d)\n", msgType, msg.ID)
+		fmt.Printf("⏭️  %s跳过: 未提取到有效链接 (ID=%d, 规则=%s)\n", msgType, msg.ID, rules.Summary())
+		rec.skip(dryRunStageLinks)
 		return 0, 0, nil
 	}
+	rec.pass(dryRunStageLinks)
+	if rec != nil {
+		rec.Found = links
+	}
 
 	// 过滤黑名单链接
-	filteredLinks := p.FilterLinks(links, p.config.Monitor.Filters.LinkBlacklist)
+	filteredLinks := p.FilterLinks(links, rules.LinkBlacklist)
 	if len(filteredLinks) == 0 {
-		fmt.Printf("⏭️  %s跳过: 所有链接都在黑名单中 (ID=%d, 原始链接数=%d)\n", msgType, msg.ID, len(links))
+		fmt.Printf("⏭️  %s跳过: 所有链接都在黑名单中 (ID=%d, 原始链接数=%d, 规则=%s)\n", msgType, msg.ID, len(links), rules.Summary())
+		rec.skip(dryRunStageBlack)
 		return 0, 0, nil
 	}
+	rec.pass(dryRunStageBlack)
+
+	// 执行表达式规则
+	if len(rules.Rules) > 0 {
+		filteredLinks = p.applyFilterRules(rules.Rules, newRuleEnv(msg, peerID, text), filteredLinks, msgType, msg.ID)
+		if len(filteredLinks) == 0 {
+			fmt.Printf("⏭️  %s跳过: 所有链接都被表达式规则过滤 (ID=%d, 规则=%s)\n", msgType, msg.ID, rules.Summary())
+			rec.skip(dryRunStageRules)
+			return 0, 0, nil
+		}
+		rec.pass(dryRunStageRules)
+	}
+
+	// 过滤频道不接受的协议
+	if len(rules.Protocols) > 0 {
+		var allowed []string
+		for _, link := range filteredLinks {
+			if rules.AllowsLink(link) {
+				allowed = append(allowed, link)
+			}
+		}
+		if len(allowed) == 0 {
+			fmt.Printf("⏭️  %s跳过: 没有频道允许的协议 (ID=%d, 规则=%s)\n", msgType, msg.ID, rules.Summary())
+			rec.skip(dryRunStageProtocol)
+			return 0, 0, nil
+		}
+		rec.pass(dryRunStageProtocol)
+		filteredLinks = allowed
+	}
+
+	// 编辑消息只保留相对上次新增的链接（消息未记录过时全部处理）
+	currentLinks, extracted = filteredLinks, true
+	if hasPrevious {
+		added, _ := diffLinks(previousLinks, filteredLinks)
+		if len(added) == 0 {
+			fmt.Printf("⏭️  %s跳过: 没有新增链接 (ID=%d, 已处理链接数=%d)\n", msgType, msg.ID, len(previousLinks))
+			rec.skip(dryRunStageEdit)
+			return 0, 0, nil
+		}
+		fmt.Printf("✏️  %s新增链接: %d 个 (ID=%d, 已处理链接数=%d)\n", msgType, len(added), msg.ID, len(previousLinks))
+		rec.pass(dryRunStageEdit)
+		filteredLinks = added
+	}
 
 	// 分组：订阅和节点
 	var subscriptions []string
 	var nodes []string
+	var claimed []string // 通过指纹去重、尚未提交完成的节点（加入批次时交给批次释放）
+	defer func() { p.nodeDedup.Release(claimed) }()
 
 	for _, link := range filteredLinks {
 		if p.IsProxyNode(link) {
@@ -242,6 +346,37 @@ func (p *MessageProcessor) processMessageContent(ctx context.Context, msg *tg.Me
 		}
 	}
 
+	if len(nodes) > 0 {
+		// 校验节点链接：修剪末尾多余字符，丢弃缺少必需字段的节点
+		validNodes, repaired, rejected := validateNodeLinks(nodes)
+		for _, r := range rejected {
+			fmt.Printf("🚫 %s丢弃无效节点 (ID=%d, 原因=%s): %.80s\n", msgType, msg.ID, r.Reason, r.Link)
+			p.stats.RecordInvalid(peerID, r.Reason)
+		}
+		if repaired > 0 {
+			fmt.Printf("🛠️  %s修复节点链接: %d 个 (ID=%d)\n", msgType, repaired, msg.ID)
+			p.stats.Update(peerID, func(s *ChannelStats) { s.Repaired += int64(repaired) })
+		}
+
+		// 按规范化指纹去除重复节点（同一服务器仅备注或参数顺序不同）
+		var duplicates int
+		nodes, duplicates = p.nodeDedup.Filter(validNodes)
+		claimed = nodes
+		if duplicates > 0 {
+			fmt.Printf("♻️  %s跳过重复节点: %d 个 (ID=%d)\n", msgType, duplicates, msg.ID)
+			p.stats.Update(peerID, func(s *ChannelStats) { s.Duplicates += int64(duplicates) })
+		}
+
+		// 本地探测连通性，丢弃不可达的节点
+		nodes = p.probeNodes(ctx, nodes, peerID, msgType)
+		if len(nodes) == 0 && len(subscriptions) == 0 {
+			fmt.Printf("⏭️  %s跳过: 没有可提交的新节点 (ID=%d)\n", msgType, msg.ID)
+			rec.skip(dryRunStageNodes)
+			return 0, 0, nil
+		}
+		rec.pass(dryRunStageNodes)
+	}
+
 	subsCount := 0
 	nodeCount := 0
 
@@ -253,120 +388,73 @@ func (p *MessageProcessor) processMessageContent(ctx context.Context, msg *tg.Me
 	fmt.Printf("🔗 %s提取到 %d 个有效链接，准备提交... (ID=%d)\n", msgTypeLabel, len(filteredLinks), msg.ID)
 	// fmt.Printf("[DEBUG] 准备发送链接到API (message_id=%d, type=%s, subscriptions_count=%d, nodes_count=%d)\n", msg.ID, msgTypeLabel, len(subscriptions), len(nodes))
 
-	// 处理订阅（逐个调用addSubscription）
-	for _, subLink := range subscriptions {
-		// fmt.Printf("[DEBUG] 调用addSubscription (link=%s)\n", subLink)
-		if err := p.addSubscription(subLink); err != nil {
-			fmt.Printf("%s-发送订阅失败 (link=%s): %v\n", msgTypeLabel, subLink, err)
-		} else {
-			subsCount++
-			// fmt.Printf("[DEBUG] %s-新订阅 (channel=%d, link=%s)\n", msgTypeLabel, peerID, subLink)
+	sinks := p.sinks.ForRules(rules)
+	if len(sinks) == 0 {
+		fmt.Printf("⚠️  %s没有可用的输出目标 (ID=%d, 规则=%s)\n", msgTypeLabel, msg.ID, rules.Summary())
+	}
 
-			emoji := "✅"
-			if isEdited {
-				emoji = "🔄"
+	// 演练模式：订阅预检照常执行，记录将会提交的链接和输出目标，不实际提交
+	if rec != nil {
+		var checked []string
+		for _, subLink := range subscriptions {
+			if check, ok := p.precheckSubscription(ctx, subLink, peerID); !ok {
+				rec.skipLink(DryRunLink{Link: subLink, Kind: "subscription", Skipped: check.String()})
+				continue
 			}
-			fmt.Printf("%s %s-新订阅: %s (频道: %d)\n", emoji, msgTypeLabel, subLink, peerID)
+			checked = append(checked, subLink)
 		}
+		subsCount, nodeCount = p.dryRunSubmit(rec, sinks, checked, nodes)
+		if subsCount == 0 && nodeCount == 0 {
+			rec.skip(dryRunStageSinks)
+		}
+		fmt.Printf("🧪 %s演练: 将提交订阅 %d 个, 节点 %d 个 (ID=%d, 频道: %d)\n", msgTypeLabel, subsCount, nodeCount, msg.ID, peerID)
+		return subsCount, nodeCount, nil
 	}
 
-	// 处理节点（批量汇总提交）
-	if len(nodes) > 0 {
-		// fmt.Printf("[DEBUG] 开始批量提交 %d 个节点\n", len(nodes))
-
-		if !p.config.Monitor.Enabled || p.config.Monitor.SubscriptionAPI.AddURL == "" {
-			fmt.Printf("⚠️  订阅 API 未配置或未启用\n")
-		} else {
-			apiURL := p.config.Monitor.SubscriptionAPI.AddURL
-
-			// 将多个节点用\n连接
-			batchSS := strings.Join(nodes, "\n")
+	emoji := "✅"
+	if isEdited {
+		emoji = "🔄"
+	}
 
-			type SubscriptionRequest struct {
-				SubURL string `json:"sub_url,omitempty"`
-				SS     string `json:"ss,omitempty"`
-				Test   bool   `json:"test"`
-			}
+	// 处理订阅（逐个提交到各输出目标）
+	for _, subLink := range subscriptions {
+		if _, ok := p.precheckSubscription(ctx, subLink, peerID); !ok {
+			continue
+		}
+		if delivered := p.submitToSinks(ctx, sinks, newSinkItems([]string{subLink}, peerID, msg.ID), false, msgTypeLabel); len(delivered) > 0 {
+			subsCount++
+			fmt.Printf("%s %s-新订阅: %s (频道: %d)\n", emoji, msgTypeLabel, subLink, peerID)
+		}
+	}
 
-			reqBody := SubscriptionRequest{
-				SS:   batchSS,
-				Test: true,
-			}
+	// 处理节点（批量汇总提交到各输出目标）
+	nodesQueued := false
+	if len(nodes) > 0 && len(sinks) > 0 && p.batcher != nil {
+		// 加入跨消息批次，提交结果在批次提交时按来源频道统计
+		p.batcher.Add(sinks, newSinkItems(nodes, peerID, msg.ID))
+		claimed = nil
+		nodeCount = len(nodes)
+		nodesQueued = true
+		fmt.Printf("📥 %s-节点加入批次: %d个 (频道: %d, 待提交: %d)\n", msgTypeLabel, nodeCount, peerID, p.batcher.Pending())
+	} else if len(nodes) > 0 {
+		// fmt.Printf("[DEBUG] 开始批量提交 %d 个节点\n", len(nodes))
+		delivered := p.submitToSinks(ctx, sinks, newSinkItems(nodes, peerID, msg.ID), true, msgTypeLabel)
+		nodeCount = len(delivered)
+		if nodeCount > 0 {
+			fmt.Printf("%s %s-批量节点: %d个 (频道: %d)\n", emoji, msgTypeLabel, nodeCount, peerID)
 
-			jsonData, err := json.Marshal(reqBody)
-			if err != nil {
-				// fmt.Printf("[DEBUG] JSON 序列化失败: %v\n", err)
-			} else {
-				req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-				if err != nil {
-					// fmt.Printf("[DEBUG] 创建请求失败: %v\n", err)
-				} else {
-					req.Header.Set("X-API-Key", p.config.Monitor.SubscriptionAPI.ApiKey)
-					req.Header.Set("Content-Type", "application/json")
-
-					client := &http.Client{Timeout: 120 * time.Second}
-					resp, err := client.Do(req)
-					if err != nil {
-						// fmt.Printf("[DEBUG] 批量节点 API 请求失败: %v\n", err)
-					} else {
-						defer resp.Body.Close()
-
-						body, err := io.ReadAll(resp.Body)
-						if err != nil {
-							// fmt.Printf("[DEBUG] 读取响应失败: %v\n", err)
-						} else {
-							// 记录原始响应（用于调试）
-							// fmt.Printf("[DEBUG] 批量节点API 响应 (status=%d, body=%s)\n", resp.StatusCode, string(body))
-
-							var response SubscriptionResponse
-							if err := json.Unmarshal(body, &response); err != nil {
-								// fmt.Printf("[DEBUG] 批量节点响应解析失败 (error=%v, body=%s, status=%d)\n", err, string(body), resp.StatusCode)
-								// 如果是 200 状态码但解析失败，可能是纯文本响应，视为成功
-								if resp.StatusCode == 200 {
-									nodeCount = len(nodes)
-									// fmt.Printf("[DEBUG] %s批量节点添加成功 (node_count=%d)\n", msgTypeLabel, len(nodes))
-								}
-							} else {
-								// 处理响应
-								if resp.StatusCode == 200 {
-									if response.TestedNodes != nil {
-										// 检测模式响应 - 记录简洁日志
-										fmt.Printf("✅ %s批量节点检测完成 (node_count=%d, tested=%d, passed=%v, failed=%v, added=%v, duration=%s)\n",
-											msgTypeLabel, len(nodes), *response.TestedNodes, response.PassedNodes, response.FailedNodes, response.AddedNodes, response.Duration)
-										nodeCount = len(nodes)
-									} else {
-										// 普通模式响应
-										fmt.Printf("✅ %s批量节点添加成功 (node_count=%d)\n", msgTypeLabel, len(nodes))
-										nodeCount = len(nodes)
-									}
-									emoji := "✅"
-									if isEdited {
-										emoji = "🔄"
-									}
-									fmt.Printf("%s %s-批量节点: %d个 (频道: %d)\n", emoji, msgTypeLabel, len(nodes), peerID)
-								} else if resp.StatusCode == 409 {
-									// fmt.Printf("[DEBUG] %s批量节点已存在 (node_count=%d)\n", msgTypeLabel, len(nodes))
-									nodeCount = len(nodes)
-									emoji := "⚠️"
-									if isEdited {
-										emoji = "🔄"
-									}
-									fmt.Printf("%s %s-批量节点已存在: %d个 (频道: %d)\n", emoji, msgTypeLabel, len(nodes), peerID)
-								} else {
-									errorMsg := response.Error
-									if errorMsg == "" {
-										errorMsg = response.Message
-									}
-									// fmt.Printf("[DEBUG] %s批量节点提交失败 (node_count=%d, error=%s)\n", msgTypeLabel, len(nodes), errorMsg)
-								}
-							}
-						}
-					}
-				}
-			}
+			// 记录已成功提交的节点指纹
+			p.nodeDedup.Mark(sinkItemLinks(delivered))
 		}
 	}
 
+	p.stats.Update(peerID, func(s *ChannelStats) {
+		s.Subscriptions += int64(subsCount)
+		if !nodesQueued {
+			s.Nodes += int64(nodeCount)
+		}
+	})
+
 	// 输出处理结果摘要
 	if subsCount > 0 || nodeCount > 0 {
 		fmt.Printf("✅ %s处理完成: 有效订阅=%d, 有效节点=%d (ID=%d)\n", msgTypeLabel, subsCount, nodeCount, msg.ID)
@@ -377,205 +465,23 @@ func (p *MessageProcessor) processMessageContent(ctx context.Context, msg *tg.Me
 	return subsCount, nodeCount, nil
 }
 
-// addSubscription 添加订阅或单个节点
-func (p *MessageProcessor) addSubscription(link string) error {
-	// fmt.Printf("[DEBUG] 进入addSubscription函数 (link=%s)\n", link)
-	if !p.config.Monitor.Enabled || p.config.Monitor.SubscriptionAPI.AddURL == "" {
-		fmt.Printf("⚠️  订阅 API 未配置或未启用 (enabled=%v, api_url=%s)\n", p.config.Monitor.Enabled, p.config.Monitor.SubscriptionAPI.AddURL)
-		return fmt.Errorf("订阅 API 未配置")
-	}
-
-	// 使用配置文件中的完整 URL
-	apiURL := p.config.Monitor.SubscriptionAPI.AddURL
-
-	// 判断是订阅链接还是单个节点
-	isNodeLink := p.IsProxyNode(link)
-
-	// 构建请求体
-	type SubscriptionRequest struct {
-		SubURL string `json:"sub_url,omitempty"`
-		SS     string `json:"ss,omitempty"`
-		Test   bool   `json:"test"`
-	}
-
-	var reqBody SubscriptionRequest
-	if isNodeLink {
-		reqBody.SS = link
-	} else {
-		reqBody.SubURL = link
-	}
-	reqBody.Test = true
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("JSON 序列化失败: %w", err)
-	}
-
-	// 创建请求
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("创建请求失败: %w", err)
-	}
-
-	req.Header.Set("X-API-Key", p.config.Monitor.SubscriptionAPI.ApiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	// 发送请求
-	client := &http.Client{Timeout: 120 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("API 请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("读取响应失败: %w", err)
-	}
-
-	// 记录原始响应（用于调试）
-	linkType := "订阅"
-	if isNodeLink {
-		linkType = "节点"
-	}
-	// fmt.Printf("[DEBUG] API 响应 (type=%s, status=%d, body=%s)\n", linkType, resp.StatusCode, string(body))
-
-	// 解析响应
-	var response SubscriptionResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		// fmt.Printf("[DEBUG] 解析响应失败 (error=%v, body=%s, status=%d)\n", err, string(body), resp.StatusCode)
-
-		// 如果是 200 状态码但解析失败，可能是纯文本响应，视为成功
-		if resp.StatusCode == 200 {
-			// fmt.Printf("[DEBUG] %s添加成功（纯文本响应） (link=%s)\n", linkType, link)
-			return nil
-		}
-		return fmt.Errorf("解析响应失败 (状态码: %d): %w", resp.StatusCode, err)
-	}
-
-	// 处理响应
-	if resp.StatusCode == 200 {
-		// 检查是否为检测模式响应
-		if response.TestedNodes != nil {
-			// 检测模式响应 - 记录详细统计信息
-			fmt.Printf("✅ %s检测并添加成功 (link=%s, tested=%d, passed=%v, failed=%v, added=%v, duration=%s, timeout=%v)\n",
-				linkType, link, *response.TestedNodes, response.PassedNodes, response.FailedNodes, response.AddedNodes, response.Duration, response.Timeout)
-			if response.Timeout != nil && *response.Timeout {
-				fmt.Printf("⚠️  %s检测超时 (warning=%s)\n", linkType, response.Warning)
-			}
-		} else {
-			// 普通模式响应
-			successMsg := response.Message
-			if successMsg == "" {
-				successMsg = linkType + "添加成功"
-			}
-			fmt.Printf("✅ %s添加成功 (link=%s, message=%s)\n", linkType, link, successMsg)
-		}
-		return nil
-	}
-
-	// 处理重复（409 Conflict）- 不作为错误
-	if resp.StatusCode == 409 || resp.StatusCode == http.StatusConflict {
-		errorMsg := response.Error
-		if errorMsg == "" {
-			if isNodeLink {
-				errorMsg = "节点已存在"
-			} else {
-				errorMsg = "该订阅链接已存在"
-			}
-		}
-		// fmt.Printf("[DEBUG] %s已存在 (link=%s)\n", linkType, link)
-		return nil // 不返回错误，避免重复日志
-	}
-
-	// 其他错误处理
-	errorMsg := response.Error
-	if errorMsg == "" {
-		errorMsg = response.Message
-	}
-	if errorMsg == "" {
-		errorMsg = fmt.Sprintf(linkType+"添加失败 (状态码: %d)", resp.StatusCode)
-	}
-
-	return fmt.Errorf("%s", errorMsg)
-}
-
 // fetchChannelHistory 获取频道历史消息
+// 已有高水位记录的频道只获取比记录更新的消息，首次见到的频道最多获取 limit 条
 func (p *MessageProcessor) fetchChannelHistory(ctx context.Context, channelID int64, limit int) error {
-	fmt.Printf("📥 开始获取频道 %d 的历史消息（最多 %d 条）...\n", channelID, limit)
-
-	// 保存频道名称
-	var channelTitle string
-
-	// 构造 InputPeerChannel
-	inputPeer := &tg.InputPeerChannel{
-		ChannelID:  channelID,
-		AccessHash: 0, // 需要从对话列表中获取
+	minID := p.historyResumeIDs[channelID]
+	if minID > 0 {
+		fmt.Printf("📥 开始获取频道 %d 的历史消息（从消息 %d 之后续取）...\n", channelID, minID)
+	} else {
+		fmt.Printf("📥 开始获取频道 %d 的历史消息（首次获取，最多 %d 条）...\n", channelID, limit)
 	}
 
-	// 尝试通过 ChannelsGetChannels 获取频道信息
-	channel, err := p.api.ChannelsGetChannels(ctx, []tg.InputChannelClass{
-		&tg.InputChannel{
-			ChannelID:  channelID,
-			AccessHash: 0,
-		},
-	})
-
+	// 通过统一的对等体解析器获取频道信息和 AccessHash
+	channel, err := p.peers.Channel(ctx, channelID)
 	if err != nil {
-		// 如果失败，从对话列表中查找 AccessHash
-		dialogs, err := p.api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
-			OffsetDate: 0,
-			OffsetID:   0,
-			OffsetPeer: &tg.InputPeerEmpty{},
-			Limit:      100,
-			Hash:       0,
-		})
-
-		if err != nil {
-			return fmt.Errorf("获取对话列表失败: %w", err)
-		}
-
-		// 查找对应的频道
-		var accessHash int64
-		var foundChannel *tg.Channel
-		switch d := dialogs.(type) {
-		case *tg.MessagesDialogs:
-			for _, chat := range d.Chats {
-				if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
-					accessHash = ch.AccessHash
-					foundChannel = ch
-					break
-				}
-			}
-		case *tg.MessagesDialogsSlice:
-			for _, chat := range d.Chats {
-				if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
-					accessHash = ch.AccessHash
-					foundChannel = ch
-					break
-				}
-			}
-		}
-
-		if foundChannel == nil {
-			return fmt.Errorf("未找到频道 %d，请确认已加入该频道", channelID)
-		}
-
-		channelTitle = foundChannel.Title
-		inputPeer.AccessHash = accessHash
-	} else {
-		// 成功获取频道信息
-		switch chats := channel.(type) {
-		case *tg.MessagesChats:
-			if len(chats.Chats) > 0 {
-				if ch, ok := chats.Chats[0].(*tg.Channel); ok {
-					channelTitle = ch.Title
-					inputPeer.AccessHash = ch.AccessHash
-				}
-			}
-		}
+		return err
 	}
+	channelTitle := channel.Title
+	inputPeer := channel.InputPeer()
 
 	// 获取历史消息（分页获取以突破100条限制）
 	var allMessages []tg.MessageClass
@@ -583,10 +489,10 @@ func (p *MessageProcessor) fetchChannelHistory(ctx context.Context, channelID in
 	batchSize := 100 // Telegram API 单次最多返回100条
 	fetchedCount := 0
 
-	for fetchedCount < limit {
-		// 计算本次请求的数量
+	for minID > 0 || fetchedCount < limit {
+		// 计算本次请求的数量（续取模式不限制总数，直到到达高水位）
 		requestLimit := batchSize
-		if limit-fetchedCount < batchSize {
+		if minID == 0 && limit-fetchedCount < batchSize {
 			requestLimit = limit - fetchedCount
 		}
 
@@ -597,7 +503,7 @@ func (p *MessageProcessor) fetchChannelHistory(ctx context.Context, channelID in
 			AddOffset:  0,
 			Limit:      requestLimit,
 			MaxID:      0,
-			MinID:      0,
+			MinID:      minID, // 只返回 ID 大于高水位的消息
 			Hash:       0,
 		})
 
@@ -632,6 +538,11 @@ func (p *MessageProcessor) fetchChannelHistory(ctx context.Context, channelID in
 			break // 如果最后一条不是普通消息，退出
 		}
 
+		// 续取模式：已到达高水位，无需继续翻页
+		if minID > 0 && offsetID <= minID+1 {
+			break
+		}
+
 		// 如果返回的消息数少于请求数，说明已经没有更多消息
 		if len(batchMessages) < requestLimit {
 			break
@@ -644,49 +555,53 @@ func (p *MessageProcessor) fetchChannelHistory(ctx context.Context, channelID in
 	messages := allMessages
 	// fmt.Printf("✅ 实际获取到 %d 条历史消息\n", len(messages))
 
-	// 处理每条消息，统计有效订阅和节点
-	totalSubs := 0
-	totalNodes := 0
+	// 历史消息与实时消息一样经过处理队列，保证同一频道按顺序处理；等待处理完成后汇总统计
+	var totalSubs, totalNodes int64
+	var wg sync.WaitGroup
+	done := func(subs int, nodes int) {
+		atomic.AddInt64(&totalSubs, int64(subs))
+		atomic.AddInt64(&totalNodes, int64(nodes))
+		wg.Done()
+	}
 	totalLinks := 0                           // 提取到的订阅/节点总数
+	rules := p.channelRules(channelID)        // 频道生效的规则集（全局配置 + 频道级覆盖）
 	for i := len(messages) - 1; i >= 0; i-- { // 倒序处理，从旧到新
 		msg, ok := messages[i].(*tg.Message)
 		if !ok {
 			continue
 		}
 
-		// 获取编辑时间（如果有）
-		editDate := 0
-		if date, ok := msg.GetEditDate(); ok {
-			editDate = date
-		}
-
-		// 使用新的缓存方法进行去重检查
-		_, shouldProcess := p.messageCache.AddOrUpdate(channelID, msg.ID, editDate)
-		if !shouldProcess {
-			continue // 如果已处理，则跳过
-		}
+		// 缓存中已有的消息按编辑处理（只提交新增链接），重复的消息由处理队列中的缓存检查跳过
+		edited := p.messageCache.Has(channelID, msg.ID)
 
 		// fmt.Printf("[DEBUG] 处理历史消息 (message_id=%d, channel_id=%d)\n", msg.ID, channelID)
 
 		// 统计提取的链接数（在处理之前）
-		text := msg.Message
+		text := messageScanText(msg)
 		if text != "" {
 			// 检查是否包含订阅格式或节点格式
-			hasSubsFormat := matchAny(text, p.config.Monitor.Filters.Subs)
-			hasNodeFormat := matchAny(text, p.config.Monitor.Filters.SS)
-			if hasSubsFormat || hasNodeFormat {
-				links := p.ExtractAllLinks(text)
+			if rules.HasSubsFormat(text) || rules.HasNodeFormat(text) {
+				links := p.ExtractMessageLinks(msg)
 				if len(links) > 0 {
-					filteredLinks := p.FilterLinks(links, p.config.Monitor.Filters.LinkBlacklist)
+					filteredLinks := p.FilterLinks(links, rules.LinkBlacklist)
 					totalLinks += len(filteredLinks)
 				}
 			}
 		}
 
-		// 直接调用 processMessageContent 处理历史消息（不需要重复去重检查）
-		subsCount, nodeCount, _ := p.processMessageContent(ctx, msg, channelID, false)
-		totalSubs += subsCount
-		totalNodes += nodeCount
+		wg.Add(1)
+		if err := p.pipeline.Enqueue(ctx, queuedMessage{msg: msg, edited: edited, done: done}); err != nil {
+			fmt.Printf("⚠️  历史消息未能加入处理队列 (ID=%d): %v\n", msg.ID, err)
+			wg.Done()
+		}
+	}
+	wg.Wait()
+
+	// 首次获取的频道即使没有可处理的新消息，也记录最新消息ID作为高水位
+	if len(messages) > 0 {
+		if newest, ok := messages[0].(*tg.Message); ok {
+			p.setChannelLastMessageID(channelID, newest.ID)
+		}
 	}
 
 	// 格式化输出统计信息
@@ -719,60 +634,6 @@ func contains(slice []int64, val int64) bool {
 	return false
 }
 
-func matchAny(text string, patterns []string) bool {
-	if len(patterns) == 0 {
-		return true
-	}
-	text = strings.ToLower(text)
-	for _, pattern := range patterns {
-		if strings.Contains(text, strings.ToLower(pattern)) {
-			return true
-		}
-	}
-	return false
-}
-
-// recloneForwardedMessage 克隆转发消息（去除转发头）
-// getChannelAccessHash 获取频道的 AccessHash
-func (p *MessageProcessor) getChannelAccessHash(ctx context.Context, channelID int64) (int64, error) {
-	dialogs, err := p.api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
-		OffsetDate: 0,
-		OffsetID:   0,
-		OffsetPeer: &tg.InputPeerEmpty{},
-		Limit:      100,
-		Hash:       0,
-	})
-
-	if err != nil {
-		return 0, fmt.Errorf("获取对话列表失败: %w", err)
-	}
-
-	// 查找对应的频道
-	var accessHash int64
-	switch d := dialogs.(type) {
-	case *tg.MessagesDialogs:
-		for _, chat := range d.Chats {
-			if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
-				accessHash = ch.AccessHash
-				break
-			}
-		}
-	case *tg.MessagesDialogsSlice:
-		for _, chat := range d.Chats {
-			if ch, ok := chat.(*tg.Channel); ok && ch.ID == channelID {
-				accessHash = ch.AccessHash
-				break
-			}
-		}
-	}
-
-	if accessHash == 0 {
-		return 0, fmt.Errorf("未找到频道 %d 的 AccessHash", channelID)
-	}
-
-	return accessHash, nil
-}
-
 // recloneForwardedMessageGroup 克隆转发消息集合（去除转发头）并删除所有原始消息
 func (p *MessageProcessor) recloneForwardedMessageGroup(ctx context.Context, msg *tg.Message, channelID int64, fwdInfo tg.MessageFwdHeader, messageIDs []int) error {
 	// 构造消息链接（私有频道格式）
@@ -788,7 +649,7 @@ func (p *MessageProcessor) recloneForwardedMessageGroup(ctx context.Context, msg
 	fmt.Printf("✅ 克隆转发成功 (原消息ID=%d, 频道ID=%d)\n", msg.ID, channelID)
 
 	// 克隆成功后删除所有原始带转发头的消息
-	accessHash, err := p.getChannelAccessHash(ctx, channelID)
+	channel, err := p.peers.Channel(ctx, channelID)
 	if err != nil {
 		fmt.Printf("⚠️  获取频道 AccessHash 失败（已成功克隆） (原消息IDs=%v, 频道ID=%d): %v\n", messageIDs, channelID, err)
 		return nil
@@ -796,11 +657,8 @@ func (p *MessageProcessor) recloneForwardedMessageGroup(ctx context.Context, msg
 
 	// 使用 ChannelsDeleteMessages API 删除所有消息
 	deleteRequest := &tg.ChannelsDeleteMessagesRequest{
-		Channel: &tg.InputChannel{
-			ChannelID:  channelID,
-			AccessHash: accessHash,
-		},
-		ID: messageIDs, // 删除所有消息
+		Channel: channel.InputChannel(),
+		ID:      messageIDs, // 删除所有消息
 	}
 
 	affectedMessages, err := p.api.ChannelsDeleteMessages(ctx, deleteRequest)
@@ -814,6 +672,7 @@ func (p *MessageProcessor) recloneForwardedMessageGroup(ctx context.Context, msg
 	return nil
 }
 
+// recloneForwardedMessage 克隆转发消息（去除转发头）
 func (p *MessageProcessor) recloneForwardedMessage(ctx context.Context, msg *tg.Message, channelID int64, fwdInfo tg.MessageFwdHeader) error {
 	// 构造消息链接（私有频道格式）
 	msgLink := fmt.Sprintf("https://t.me/c/%d/%d", channelID, msg.ID)
@@ -830,7 +689,7 @@ func (p *MessageProcessor) recloneForwardedMessage(ctx context.Context, msg *tg.
 
 	// 克隆成功后删除原始带转发头的消息
 	// 获取频道的 AccessHash
-	accessHash, err := p.getChannelAccessHash(ctx, channelID)
+	channel, err := p.peers.Channel(ctx, channelID)
 	if err != nil {
 		fmt.Printf("⚠️  获取频道 AccessHash 失败（已成功克隆） (原消息ID=%d, 频道ID=%d): %v\n", msg.ID, channelID, err)
 		return nil // 不返回错误，因为克隆已经成功
@@ -838,11 +697,8 @@ func (p *MessageProcessor) recloneForwardedMessage(ctx context.Context, msg *tg.
 
 	// 使用 ChannelsDeleteMessages API 删除频道消息
 	deleteRequest := &tg.ChannelsDeleteMessagesRequest{
-		Channel: &tg.InputChannel{
-			ChannelID:  channelID,
-			AccessHash: accessHash,
-		},
-		ID: []int{msg.ID},
+		Channel: channel.InputChannel(),
+		ID:      []int{msg.ID},
 	}
 
 	affectedMessages, err := p.api.ChannelsDeleteMessages(ctx, deleteRequest)
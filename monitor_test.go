@@ -0,0 +1,71 @@
+// tdl-msgproce - 监听会话与消息来源检查测试
+package main
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestIsMonitoredPeer(t *testing.T) {
+	cfg := &Config{}
+	cfg.Monitor.Enabled = true
+	cfg.Monitor.Channels = []int64{1001}
+	cfg.Monitor.Features.AutoRecloneForwards = true
+	cfg.Bot.ForwardTarget = 2002
+	p := &MessageProcessor{config: cfg}
+
+	tests := []struct {
+		peerID int64
+		want   bool
+	}{
+		{1001, true},
+		{2002, true}, // forward_target 例外
+		{3003, false},
+	}
+	for _, tt := range tests {
+		if got := p.isMonitoredPeer(tt.peerID); got != tt.want {
+			t.Errorf("isMonitoredPeer(%d) = %v, want %v", tt.peerID, got, tt.want)
+		}
+	}
+
+	// 未启用监听（例如只配置了签到或 Bot）时不处理任何会话
+	cfg.Monitor.Enabled = false
+	cfg.Monitor.Channels = nil
+	if p.isMonitoredPeer(1001) {
+		t.Errorf("监听未启用时 isMonitoredPeer = true")
+	}
+}
+
+func TestIsOwnMessage(t *testing.T) {
+	cfg := &Config{}
+	cfg.Monitor.Features.AutoRecloneForwards = true
+	cfg.Bot.ForwardTarget = 2002
+	p := &MessageProcessor{config: cfg, selfUserID: 42}
+
+	fromSelf := &tg.Message{}
+	fromSelf.SetFromID(&tg.PeerUser{UserID: 42})
+	fromOther := &tg.Message{}
+	fromOther.SetFromID(&tg.PeerUser{UserID: 7})
+	forwarded := &tg.Message{Out: true}
+	forwarded.SetFwdFrom(tg.MessageFwdHeader{})
+
+	tests := []struct {
+		name   string
+		msg    *tg.Message
+		peerID int64
+		want   bool
+	}{
+		{"其他用户", fromOther, 1001, false},
+		{"频道消息", &tg.Message{}, 1001, false},
+		{"发出的消息", &tg.Message{Out: true}, 1001, true},
+		{"本账号发送", fromSelf, 1001, true},
+		{"forward_target 中待克隆的转发", forwarded, 2002, false},
+		{"其他会话中的转发", forwarded, 1001, true},
+	}
+	for _, tt := range tests {
+		if got := p.isOwnMessage(tt.msg, tt.peerID); got != tt.want {
+			t.Errorf("%s: isOwnMessage = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
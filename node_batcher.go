@@ -0,0 +1,230 @@
+// tdl-msgproce - 跨消息的节点批量提交窗口
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchWindow   = 30 * time.Second // 默认批次窗口
+	defaultBatchMaxNodes = 200              // 默认批次最大节点数
+	batcherDrainTimeout  = 5 * time.Minute  // 退出时提交剩余批次的最长时间
+)
+
+// nodeBatch 发往同一组输出目标的待提交节点
+type nodeBatch struct {
+	sinks []Sink
+	items []sinkItem
+	timer *time.Timer
+}
+
+// NodeBatcher 汇总所有频道在窗口期内提取的节点，去重后作为一个批次提交，
+// 避免短时间内大量单节点消息各自触发一次 API 检测
+type NodeBatcher struct {
+	p        *MessageProcessor
+	window   time.Duration
+	maxNodes int
+
+	mu      sync.Mutex
+	batches map[string]*nodeBatch // 输出目标组合 -> 批次
+	closed  bool
+	drained chan struct{} // 剩余批次提交完成后关闭
+
+	submitMu sync.Mutex // 批次按顺序提交
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewNodeBatcher 创建节点批量提交器
+func NewNodeBatcher(p *MessageProcessor, window time.Duration, maxNodes int) *NodeBatcher {
+	if window <= 0 {
+		window = defaultBatchWindow
+	}
+	if maxNodes <= 0 {
+		maxNodes = defaultBatchMaxNodes
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &NodeBatcher{
+		p:        p,
+		window:   window,
+		maxNodes: maxNodes,
+		batches:  make(map[string]*nodeBatch),
+		drained:  make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// sinkSetKey 输出目标组合的键
+func sinkSetKey(sinks []Sink) string {
+	names := make([]string, 0, len(sinks))
+	for _, sink := range sinks {
+		names = append(names, sink.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Add 将节点加入批次；首个节点启动窗口计时，达到最大节点数时立即提交
+func (b *NodeBatcher) Add(sinks []Sink, items []sinkItem) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		b.submit(&nodeBatch{sinks: sinks, items: items})
+		return
+	}
+
+	key := sinkSetKey(sinks)
+	batch, ok := b.batches[key]
+	if !ok {
+		batch = &nodeBatch{sinks: sinks}
+		owner := batch
+		batch.timer = time.AfterFunc(b.window, func() { b.flush(key, owner) })
+		b.batches[key] = batch
+	}
+	batch.items = append(batch.items, items...)
+	full := len(batch.items) >= b.maxNodes
+	if full {
+		batch.timer.Stop()
+		delete(b.batches, key)
+		b.wg.Add(1)
+	}
+	b.mu.Unlock()
+
+	if full {
+		go func() {
+			defer b.wg.Done()
+			b.submit(batch)
+		}()
+	}
+}
+
+// flush 窗口到期后提交批次
+// 只提交启动该计时器的批次：批次已提前提交后，迟到的计时器不会提交同一键下新开始的批次
+func (b *NodeBatcher) flush(key string, owner *nodeBatch) {
+	b.mu.Lock()
+	batch, ok := b.batches[key]
+	ok = ok && batch == owner
+	if ok {
+		delete(b.batches, key)
+		b.wg.Add(1)
+	}
+	b.mu.Unlock()
+
+	if ok {
+		defer b.wg.Done()
+		b.submit(batch)
+	}
+}
+
+// submit 提交一个批次
+func (b *NodeBatcher) submit(batch *nodeBatch) {
+	b.submitMu.Lock()
+	defer b.submitMu.Unlock()
+	b.p.submitNodeBatch(b.ctx, batch.sinks, batch.items)
+}
+
+// Pending 返回等待提交的节点数
+func (b *NodeBatcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := 0
+	for _, batch := range b.batches {
+		pending += len(batch.items)
+	}
+	return pending
+}
+
+// Close 立即提交所有未到期的批次并等待提交完成，超时后取消剩余提交
+// 重复调用时等待首次调用提交完成
+func (b *NodeBatcher) Close(timeout time.Duration) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		<-b.drained
+		return
+	}
+	defer close(b.drained)
+	b.closed = true
+	var remaining []*nodeBatch
+	for key, batch := range b.batches {
+		batch.timer.Stop()
+		remaining = append(remaining, batch)
+		delete(b.batches, key)
+	}
+	b.mu.Unlock()
+
+	if len(remaining) > 0 {
+		fmt.Printf("⏳ 提交剩余节点批次 (%d 个批次)...\n", len(remaining))
+	}
+	done := make(chan struct{})
+	go func() {
+		for _, batch := range remaining {
+			b.submit(batch)
+		}
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		fmt.Printf("⚠️  节点批次提交超时，取消剩余提交\n")
+		b.cancel()
+		<-done
+	}
+	b.cancel()
+}
+
+// submitNodeBatch 按指纹去重后提交一批节点，并把提交结果归属到各来源频道
+func (p *MessageProcessor) submitNodeBatch(ctx context.Context, sinks []Sink, items []sinkItem) {
+	// 批次内的节点在加入时已占用指纹，提交结束后释放（成功的节点已 Mark）
+	defer p.nodeDedup.Release(sinkItemLinks(items))
+
+	seen := make(map[string]bool)
+	var unique []sinkItem
+	for _, item := range items {
+		if node, err := ParseProxyNode(item.Link); err == nil {
+			fp := node.Fingerprint()
+			if seen[fp] {
+				p.stats.Update(item.ChannelID, func(s *ChannelStats) { s.Duplicates++ })
+				continue
+			}
+			seen[fp] = true
+		}
+		unique = append(unique, item)
+	}
+
+	messages := make(map[[2]int64]bool)
+	for _, item := range unique {
+		messages[[2]int64{item.ChannelID, int64(item.MessageID)}] = true
+	}
+	fmt.Printf("📦 提交节点批次: %d 个节点 (去重 %d 个, 来自 %d 条消息, %s)\n",
+		len(unique), len(items)-len(unique), len(messages), describeSources(unique))
+
+	delivered := p.submitToSinks(ctx, sinks, unique, true, "节点批次")
+	if len(delivered) == 0 {
+		return
+	}
+
+	// 记录已成功提交的节点指纹，并按来源频道统计
+	p.nodeDedup.Mark(sinkItemLinks(delivered))
+	perChannel := make(map[int64]int64)
+	for _, item := range delivered {
+		perChannel[item.ChannelID]++
+	}
+	for channelID, count := range perChannel {
+		p.stats.Update(channelID, func(s *ChannelStats) { s.Nodes += count })
+	}
+	fmt.Printf("✅ 节点批次提交完成: %d/%d 个节点 (%s)\n", len(delivered), len(unique), describeSources(delivered))
+}
@@ -0,0 +1,44 @@
+// tdl-msgproce - 节点批量提交测试
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNodeBatcherStaleTimer(t *testing.T) {
+	api := &fakeSink{sinkBase: sinkBase{name: defaultSink}, status: SubmitAdded}
+	p := newTestOutboxProcessor(t, api)
+	sinks := []Sink{api}
+	key := sinkSetKey(sinks)
+	links := []string{"trojan://pw@a.com:443#A", "trojan://pw@b.com:443#B", "trojan://pw@c.com:443#C"}
+
+	b := NewNodeBatcher(p, time.Hour, 2)
+	b.Add(sinks, newSinkItems(links[:1], 1001, 1))
+	first := b.batches[key]
+
+	// 达到最大节点数提前提交，随后同一键下开始新的批次
+	b.Add(sinks, newSinkItems(links[1:2], 1001, 2))
+	b.Add(sinks, newSinkItems(links[2:], 1002, 3))
+
+	// 首个批次的计时器可能在 Stop 之前已触发、正在等锁；迟到的计时器不能提交新批次
+	b.flush(key, first)
+	if pending := b.Pending(); pending != 1 {
+		t.Fatalf("迟到的计时器提交了新批次: Pending = %d, want 1", pending)
+	}
+
+	b.wg.Wait()
+	if want := [][]string{links[:2]}; !reflect.DeepEqual(api.submitted, want) {
+		t.Fatalf("提前提交 = %v, want %v", api.submitted, want)
+	}
+
+	// 新批次在关闭时（或自身窗口到期时）提交
+	b.Close(time.Second)
+	if want := [][]string{links[:2], links[2:]}; !reflect.DeepEqual(api.submitted, want) {
+		t.Errorf("提交 = %v, want %v", api.submitted, want)
+	}
+	if stats := p.stats.Snapshot(); stats[1001].Nodes != 2 || stats[1002].Nodes != 1 {
+		t.Errorf("Nodes = %d/%d, want 2/1", stats[1001].Nodes, stats[1002].Nodes)
+	}
+}
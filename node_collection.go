@@ -0,0 +1,257 @@
+// tdl-msgproce - 本地节点集合输出（base64 订阅、Clash、sing-box 文件）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	sinkTypeCollection = "collection" // 在 DataDir 中维护去重的节点集合文件
+
+	defaultCollectionDir    = "subscription"   // 默认输出目录（相对 DataDir）
+	defaultCollectionMaxAge = 72 * time.Hour   // 默认节点保留时间
+	collectionPruneInterval = 10 * time.Minute // 定期清理过期节点的间隔
+)
+
+// collectionProtocols 节点集合接收的协议（别名已规范化）
+// http / https 订阅链接带端口时也能被解析出服务器和端口，不能只凭解析成功判断是节点
+var collectionProtocols = map[string]bool{
+	"vmess":     true,
+	"vless":     true,
+	"trojan":    true,
+	"ss":        true,
+	"ssr":       true,
+	"hysteria":  true,
+	"hysteria2": true,
+	"tuic":      true,
+	"juicity":   true,
+	"anytls":    true,
+	"wireguard": true,
+	"socks":     true,
+	"snell":     true,
+	"mieru":     true,
+	"sudoku":    true,
+}
+
+// collectedNode 集合中的节点
+type collectedNode struct {
+	Link string `json:"link"`
+	Seen int64  `json:"seen"` // 最近一次收到的时间（Unix 秒）
+}
+
+// collectionSink 按指纹去重的节点集合，每次变更后原子写入：
+//   - v2ray.txt：base64 编码的分享链接列表
+//   - clash.yaml：Clash proxies
+//   - sing-box.json：sing-box outbounds
+type collectionSink struct {
+	sinkBase
+	dir    string
+	maxAge time.Duration
+
+	mu    sync.Mutex
+	nodes map[string]collectedNode // 指纹 -> 节点
+}
+
+// newCollectionSink 创建节点集合并加载已保存的节点
+func newCollectionSink(base sinkBase, dir string, maxAge time.Duration) *collectionSink {
+	s := &collectionSink{
+		sinkBase: base,
+		dir:      dir,
+		maxAge:   maxAge,
+		nodes:    make(map[string]collectedNode),
+	}
+	var nodes map[string]collectedNode
+	if found, err := loadJSONFile(filepath.Join(dir, "nodes.json"), &nodes); err != nil {
+		fmt.Printf("⚠️  加载节点集合 %s 失败: %v\n", base.name, err)
+	} else if found && nodes != nil {
+		s.nodes = nodes
+		fmt.Printf("💾 已加载节点集合 %s: %d 个\n", base.name, len(nodes))
+	}
+	return s
+}
+
+// Accepts 只接收可解析的节点协议链接（不接收订阅链接）
+func (s *collectionSink) Accepts(link string) bool {
+	if !s.sinkBase.Accepts(link) {
+		return false
+	}
+	node, err := ParseProxyNode(link)
+	return err == nil && collectionProtocols[node.Protocol]
+}
+
+func (s *collectionSink) Submit(ctx context.Context, links []string, isNode bool) (*SubmitResult, error) {
+	if !isNode {
+		return &SubmitResult{Status: SubmitRejected, Attempts: 1}, fmt.Errorf("节点集合不接收订阅链接")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	for _, link := range links {
+		node, err := ParseProxyNode(link)
+		if err != nil || !collectionProtocols[node.Protocol] {
+			continue
+		}
+		s.nodes[node.Fingerprint()] = collectedNode{Link: link, Seen: now}
+	}
+	s.pruneLocked()
+	return localResult(s.writeLocked())
+}
+
+// Retract 移除指纹匹配的节点，有变更时重写文件，返回移除数量
+func (s *collectionSink) Retract(ctx context.Context, links []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for _, link := range links {
+		node, err := ParseProxyNode(link)
+		if err != nil {
+			continue
+		}
+		fp := node.Fingerprint()
+		if _, ok := s.nodes[fp]; ok {
+			delete(s.nodes, fp)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.writeLocked()
+}
+
+// Prune 清理过期节点，有变更时重写文件
+func (s *collectionSink) Prune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pruneLocked() == 0 {
+		return nil
+	}
+	return s.writeLocked()
+}
+
+// pruneLocked 删除超过保留时间的节点，返回删除数量
+func (s *collectionSink) pruneLocked() int {
+	cutoff := time.Now().Add(-s.maxAge).Unix()
+	removed := 0
+	for fp, node := range s.nodes {
+		if node.Seen < cutoff {
+			delete(s.nodes, fp)
+			removed++
+		}
+	}
+	return removed
+}
+
+// writeLocked 生成三种格式的订阅文件（按收到时间从新到旧排列）
+func (s *collectionSink) writeLocked() error {
+	nodes := make([]collectedNode, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Seen != nodes[j].Seen {
+			return nodes[i].Seen > nodes[j].Seen
+		}
+		return nodes[i].Link < nodes[j].Link
+	})
+
+	links := make([]string, 0, len(nodes))
+	var proxies []clashProxy
+	var outbounds []singBoxOutbound
+	names := make(map[string]int)
+	for _, collected := range nodes {
+		links = append(links, collected.Link)
+
+		node, err := ParseProxyNode(collected.Link)
+		if err != nil {
+			continue
+		}
+		structured, ok := node.Structured()
+		if !ok {
+			continue
+		}
+		// Clash 和 sing-box 要求节点名称唯一
+		names[structured.Name]++
+		if count := names[structured.Name]; count > 1 {
+			structured.Name = fmt.Sprintf("%s %d", structured.Name, count)
+		}
+		proxies = append(proxies, structured.Clash())
+		outbounds = append(outbounds, structured.SingBox())
+	}
+
+	clashData, err := yaml.Marshal(map[string]interface{}{"proxies": proxies})
+	if err != nil {
+		return fmt.Errorf("生成 Clash 配置失败: %w", err)
+	}
+	singBoxData, err := json.MarshalIndent(map[string]interface{}{"outbounds": outbounds}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("生成 sing-box 配置失败: %w", err)
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"v2ray.txt", []byte(base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n"))))},
+		{"clash.yaml", clashData},
+		{"sing-box.json", singBoxData},
+	}
+	for _, f := range files {
+		if err := writeFileAtomic(filepath.Join(s.dir, f.name), f.data); err != nil {
+			return fmt.Errorf("写入 %s 失败: %w", f.name, err)
+		}
+	}
+	if err := saveJSONFile(filepath.Join(s.dir, "nodes.json"), s.nodes); err != nil {
+		return fmt.Errorf("保存节点集合失败: %w", err)
+	}
+	// fmt.Printf("[DEBUG] 节点集合 %s 已更新 (节点=%d, Clash/sing-box=%d)\n", s.name, len(links), len(proxies))
+	return nil
+}
+
+// StartCollectionPruner 定期清理各节点集合中的过期节点，直到 ctx 结束
+func (r *SinkRegistry) StartCollectionPruner(ctx context.Context, interval time.Duration) {
+	var collections []*collectionSink
+	for _, sink := range r.sinks {
+		if c, ok := sink.(*collectionSink); ok {
+			collections = append(collections, c)
+		}
+	}
+	if len(collections) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, c := range collections {
+				if err := c.Prune(); err != nil {
+					fmt.Printf("⚠️  清理节点集合 %s 失败: %v\n", c.name, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// tdl-msgproce - 将分享链接转换为 Clash / sing-box 节点定义
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Structured 将解析后的分享链接转换为统一中间表示（document_scan.go 的逆过程）
+// 不支持的协议或带插件的 ss 节点返回 false
+func (n *ProxyNode) Structured() (structuredNode, bool) {
+	p := n.Params
+	node := structuredNode{
+		Type:     n.Protocol,
+		Name:     n.Name,
+		Server:   n.Server,
+		Port:     n.Port,
+		UUID:     n.UUID,
+		Password: n.Password,
+	}
+	if node.Name == "" {
+		node.Name = net.JoinHostPort(n.Server, strconv.Itoa(n.Port))
+	}
+
+	switch n.Protocol {
+	case "ss":
+		if p["plugin"] != "" {
+			return node, false
+		}
+		node.Cipher = n.Method
+		return node, node.Cipher != "" && node.Password != ""
+
+	case "vmess":
+		node.AlterID, _ = strconv.Atoi(p["aid"])
+		node.Cipher = firstNonEmpty(p["scy"], "auto")
+		node.Network = p["net"]
+		node.Host = p["host"]
+		node.Path = p["path"]
+		node.TLS = p["tls"] == "tls"
+		node.SNI = p["sni"]
+		node.Fingerprint = p["fp"]
+		if p["alpn"] != "" {
+			node.ALPN = strings.Split(p["alpn"], ",")
+		}
+		if node.Network == "grpc" {
+			node.ServiceName, node.Path = node.Path, ""
+		}
+		return node, node.UUID != ""
+
+	case "vless", "trojan":
+		node.Network = p["type"]
+		node.Path = p["path"]
+		node.Host = p["host"]
+		node.ServiceName = p["serviceName"]
+		node.Flow = p["flow"]
+		node.Fingerprint = p["fp"]
+		node.TLS = n.Protocol == "trojan" || p["security"] == "tls" || p["security"] == "reality"
+		if p["security"] == "reality" {
+			node.RealityKey = p["pbk"]
+			node.RealityID = p["sid"]
+		}
+		if (n.Protocol == "vless" && node.UUID == "") || (n.Protocol == "trojan" && node.Password == "") {
+			return node, false
+		}
+
+	case "hysteria2":
+		node.TLS = true
+		node.Obfs = p["obfs"]
+		node.ObfsPassword = p["obfs-password"]
+
+	case "hysteria":
+		node.TLS = true
+		node.Obfs = p["obfsParam"]
+		node.UpMbps, _ = strconv.Atoi(firstNonEmpty(p["upmbps"], p["up"]))
+		node.DownMbps, _ = strconv.Atoi(firstNonEmpty(p["downmbps"], p["down"]))
+
+	case "tuic":
+		node.TLS = true
+		node.Congestion = firstNonEmpty(p["congestion_control"], p["congestion-controller"])
+		if node.UUID == "" {
+			return node, false
+		}
+
+	default:
+		return node, false
+	}
+
+	node.SNI = firstNonEmpty(p["sni"], p["peer"])
+	node.Insecure = p["insecure"] == "1" || p["allowInsecure"] == "1" || p["allow_insecure"] == "1"
+	if p["alpn"] != "" {
+		node.ALPN = strings.Split(p["alpn"], ",")
+	}
+	return node, true
+}
+
+// clashProxy Clash proxies 列表中的节点（字段顺序即输出顺序）
+type clashProxy struct {
+	Name           string                 `yaml:"name"`
+	Type           string                 `yaml:"type"`
+	Server         string                 `yaml:"server"`
+	Port           int                    `yaml:"port"`
+	UUID           string                 `yaml:"uuid,omitempty"`
+	AlterID        *int                   `yaml:"alterId,omitempty"`
+	Cipher         string                 `yaml:"cipher,omitempty"`
+	Password       string                 `yaml:"password,omitempty"`
+	AuthStr        string                 `yaml:"auth-str,omitempty"`
+	UDP            bool                   `yaml:"udp"`
+	TLS            bool                   `yaml:"tls,omitempty"`
+	ServerName     string                 `yaml:"servername,omitempty"`
+	SNI            string                 `yaml:"sni,omitempty"`
+	SkipCertVerify bool                   `yaml:"skip-cert-verify,omitempty"`
+	ALPN           []string               `yaml:"alpn,omitempty"`
+	Flow           string                 `yaml:"flow,omitempty"`
+	Fingerprint    string                 `yaml:"client-fingerprint,omitempty"`
+	Network        string                 `yaml:"network,omitempty"`
+	WSOpts         map[string]interface{} `yaml:"ws-opts,omitempty"`
+	GRPCOpts       map[string]interface{} `yaml:"grpc-opts,omitempty"`
+	H2Opts         map[string]interface{} `yaml:"h2-opts,omitempty"`
+	RealityOpts    map[string]interface{} `yaml:"reality-opts,omitempty"`
+	Obfs           string                 `yaml:"obfs,omitempty"`
+	ObfsPassword   string                 `yaml:"obfs-password,omitempty"`
+	Up             int                    `yaml:"up,omitempty"`
+	Down           int                    `yaml:"down,omitempty"`
+	Congestion     string                 `yaml:"congestion-controller,omitempty"`
+}
+
+// Clash 转换为 Clash 节点定义
+func (n structuredNode) Clash() clashProxy {
+	proxy := clashProxy{
+		Name:           n.Name,
+		Type:           n.Type,
+		Server:         n.Server,
+		Port:           n.Port,
+		UUID:           n.UUID,
+		Password:       n.Password,
+		UDP:            true,
+		SkipCertVerify: n.Insecure,
+		ALPN:           n.ALPN,
+		Flow:           n.Flow,
+		Fingerprint:    n.Fingerprint,
+		Obfs:           n.Obfs,
+		ObfsPassword:   n.ObfsPassword,
+		Up:             n.UpMbps,
+		Down:           n.DownMbps,
+		Congestion:     n.Congestion,
+	}
+
+	switch n.Type {
+	case "ss":
+		proxy.Cipher = n.Cipher
+	case "vmess":
+		alterID := n.AlterID
+		proxy.AlterID = &alterID
+		proxy.Cipher = n.Cipher
+		proxy.TLS = n.TLS
+		proxy.ServerName = n.SNI
+	case "vless":
+		proxy.TLS = n.TLS
+		proxy.ServerName = n.SNI
+	case "hysteria":
+		proxy.AuthStr, proxy.Password = n.Password, ""
+		proxy.SNI = n.SNI
+	default:
+		proxy.SNI = n.SNI
+	}
+
+	switch n.Network {
+	case "ws":
+		proxy.Network = "ws"
+		opts := map[string]interface{}{}
+		if n.Path != "" {
+			opts["path"] = n.Path
+		}
+		if n.Host != "" {
+			opts["headers"] = map[string]string{"Host": n.Host}
+		}
+		proxy.WSOpts = opts
+	case "grpc":
+		proxy.Network = "grpc"
+		proxy.GRPCOpts = map[string]interface{}{"grpc-service-name": n.ServiceName}
+	case "h2", "http":
+		proxy.Network = "h2"
+		opts := map[string]interface{}{}
+		if n.Path != "" {
+			opts["path"] = n.Path
+		}
+		if n.Host != "" {
+			opts["host"] = []string{n.Host}
+		}
+		proxy.H2Opts = opts
+	}
+
+	if n.RealityKey != "" {
+		proxy.RealityOpts = map[string]interface{}{"public-key": n.RealityKey}
+		if n.RealityID != "" {
+			proxy.RealityOpts["short-id"] = n.RealityID
+		}
+	}
+	return proxy
+}
+
+// singBoxTLS sing-box 出站的 TLS 配置
+type singBoxTLS struct {
+	Enabled    bool                   `json:"enabled"`
+	ServerName string                 `json:"server_name,omitempty"`
+	Insecure   bool                   `json:"insecure,omitempty"`
+	ALPN       []string               `json:"alpn,omitempty"`
+	UTLS       map[string]interface{} `json:"utls,omitempty"`
+	Reality    map[string]interface{} `json:"reality,omitempty"`
+}
+
+// singBoxOutbound sing-box outbounds 列表中的出站
+type singBoxOutbound struct {
+	Type              string                 `json:"type"`
+	Tag               string                 `json:"tag"`
+	Server            string                 `json:"server"`
+	ServerPort        int                    `json:"server_port"`
+	UUID              string                 `json:"uuid,omitempty"`
+	AlterID           int                    `json:"alter_id,omitempty"`
+	Security          string                 `json:"security,omitempty"`
+	Method            string                 `json:"method,omitempty"`
+	Password          string                 `json:"password,omitempty"`
+	AuthStr           string                 `json:"auth_str,omitempty"`
+	Flow              string                 `json:"flow,omitempty"`
+	UpMbps            int                    `json:"up_mbps,omitempty"`
+	DownMbps          int                    `json:"down_mbps,omitempty"`
+	Obfs              interface{}            `json:"obfs,omitempty"`
+	CongestionControl string                 `json:"congestion_control,omitempty"`
+	TLS               *singBoxTLS            `json:"tls,omitempty"`
+	Transport         map[string]interface{} `json:"transport,omitempty"`
+}
+
+// SingBox 转换为 sing-box 出站定义
+func (n structuredNode) SingBox() singBoxOutbound {
+	out := singBoxOutbound{
+		Type:              n.Type,
+		Tag:               n.Name,
+		Server:            n.Server,
+		ServerPort:        n.Port,
+		UUID:              n.UUID,
+		Password:          n.Password,
+		Flow:              n.Flow,
+		UpMbps:            n.UpMbps,
+		DownMbps:          n.DownMbps,
+		CongestionControl: n.Congestion,
+	}
+
+	switch n.Type {
+	case "ss":
+		out.Type = "shadowsocks"
+		out.Method = n.Cipher
+	case "vmess":
+		out.AlterID = n.AlterID
+		out.Security = n.Cipher
+	case "hysteria":
+		out.AuthStr, out.Password = n.Password, ""
+		if n.Obfs != "" {
+			out.Obfs = n.Obfs
+		}
+	case "hysteria2":
+		if n.Obfs != "" {
+			out.Obfs = map[string]string{"type": n.Obfs, "password": n.ObfsPassword}
+		}
+	}
+
+	if n.TLS {
+		tls := &singBoxTLS{
+			Enabled:    true,
+			ServerName: n.SNI,
+			Insecure:   n.Insecure,
+			ALPN:       n.ALPN,
+		}
+		if n.Fingerprint != "" {
+			tls.UTLS = map[string]interface{}{"enabled": true, "fingerprint": n.Fingerprint}
+		}
+		if n.RealityKey != "" {
+			tls.Reality = map[string]interface{}{"enabled": true, "public_key": n.RealityKey, "short_id": n.RealityID}
+		}
+		out.TLS = tls
+	}
+
+	switch n.Network {
+	case "ws":
+		out.Transport = map[string]interface{}{"type": "ws", "path": n.Path}
+		if n.Host != "" {
+			out.Transport["headers"] = map[string]string{"Host": n.Host}
+		}
+	case "grpc":
+		out.Transport = map[string]interface{}{"type": "grpc", "service_name": n.ServiceName}
+	case "h2", "http":
+		out.Transport = map[string]interface{}{"type": "http", "path": n.Path}
+		if n.Host != "" {
+			out.Transport["host"] = []string{n.Host}
+		}
+	}
+	return out
+}
@@ -0,0 +1,464 @@
+// tdl-msgproce - 代理节点解析与规范化指纹
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const nodeFingerprintTTL = 24 * time.Hour // 已提交节点指纹的保留时间，过期后允许重新提交
+
+// ProxyNode 解析后的代理节点
+type ProxyNode struct {
+	Protocol string            // 规范化后的协议名（hy2 -> hysteria2）
+	Raw      string            // 原始链接
+	Name     string            // 备注
+	Server   string            // 服务器地址（小写，IPv6 不带方括号）
+	Port     int               // 端口
+	UUID     string            // vmess / vless / tuic / juicity 的 UUID
+	Password string            // trojan / ss / ssr / hysteria2 / tuic / juicity / anytls 的密码
+	Method   string            // ss / ssr 加密方式
+	Params   map[string]string // 其余参数（查询参数或 vmess JSON 字段）
+}
+
+// protocolAliases 协议别名
+var protocolAliases = map[string]string{
+	"hy2":         "hysteria2",
+	"shadowsocks": "ss",
+}
+
+// ParseProxyNode 将分享链接解析为结构化节点
+func ParseProxyNode(link string) (*ProxyNode, error) {
+	idx := strings.Index(link, "://")
+	if idx <= 0 {
+		return nil, fmt.Errorf("缺少协议头")
+	}
+	protocol := strings.ToLower(link[:idx])
+	if alias, ok := protocolAliases[protocol]; ok {
+		protocol = alias
+	}
+	body := link[idx+3:]
+
+	node := &ProxyNode{Protocol: protocol, Raw: link, Params: make(map[string]string)}
+
+	var err error
+	switch protocol {
+	case "vmess":
+		err = node.parseVmess(body)
+	case "ss":
+		err = node.parseSS(body)
+	case "ssr":
+		err = node.parseSSR(body)
+	default:
+		err = node.parseURL(link)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	node.Server = strings.ToLower(strings.Trim(node.Server, "[]"))
+	if node.Server == "" {
+		return nil, fmt.Errorf("缺少服务器地址")
+	}
+	if node.Port <= 0 || node.Port > 65535 {
+		return nil, fmt.Errorf("端口无效")
+	}
+	return node, nil
+}
+
+// parseURL 解析标准 URL 形式的节点（vless / trojan / hysteria / hysteria2 / tuic / juicity / anytls 等）
+func (n *ProxyNode) parseURL(link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return fmt.Errorf("链接格式错误: %w", err)
+	}
+
+	n.Server = u.Hostname()
+	n.Port, _ = strconv.Atoi(u.Port())
+	n.Name = u.Fragment
+	for key, values := range u.Query() {
+		if len(values) > 0 {
+			n.Params[key] = values[0]
+		}
+	}
+
+	if u.User != nil {
+		username := u.User.Username()
+		password, hasPassword := u.User.Password()
+		switch n.Protocol {
+		case "vless":
+			n.UUID = username
+		case "tuic", "juicity":
+			n.UUID, n.Password = username, password
+		case "hysteria2":
+			// hysteria2 的认证信息可能为 user:pass 形式
+			n.Password = username
+			if hasPassword {
+				n.Password = username + ":" + password
+			}
+		default:
+			n.Password = username
+			if hasPassword {
+				n.Password = password
+			}
+		}
+	}
+
+	if n.Protocol == "hysteria" {
+		n.Password = n.Params["auth"]
+	}
+	return nil
+}
+
+// parseVmess 解析 vmess 链接（v2rayN base64 JSON 格式，兼容 uuid@host:port 的 URL 格式）
+func (n *ProxyNode) parseVmess(body string) error {
+	payload := strings.SplitN(body, "#", 2)[0]
+	data, err := decodeBase64Loose(payload)
+	if err != nil {
+		return n.parseURL("vmess://" + body)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("vmess JSON 解析失败: %w", err)
+	}
+	for key := range raw {
+		n.Params[key] = mapString(raw, key)
+	}
+
+	n.Server = n.Params["add"]
+	n.Port = mapInt(raw, "port")
+	n.UUID = strings.ToLower(n.Params["id"])
+	n.Name = n.Params["ps"]
+	return nil
+}
+
+// parseSS 解析 ss 链接（SIP002 和旧版整体 base64 格式）
+func (n *ProxyNode) parseSS(body string) error {
+	if i := strings.Index(body, "#"); i >= 0 {
+		n.Name, _ = url.PathUnescape(body[i+1:])
+		body = body[:i]
+	}
+	if i := strings.Index(body, "?"); i >= 0 {
+		if query, err := url.ParseQuery(body[i+1:]); err == nil {
+			for key, values := range query {
+				n.Params[key] = values[0]
+			}
+		}
+		body = body[:i]
+	}
+	body = strings.TrimSuffix(body, "/")
+
+	// 旧格式：base64(method:password@host:port)
+	if !strings.Contains(body, "@") {
+		data, err := decodeBase64Loose(body)
+		if err != nil {
+			return fmt.Errorf("ss 链接 base64 解码失败")
+		}
+		body = string(data)
+	}
+
+	at := strings.LastIndex(body, "@")
+	if at < 0 {
+		return fmt.Errorf("ss 链接缺少服务器地址")
+	}
+	userInfo, hostPort := body[:at], body[at+1:]
+
+	// SIP002：userinfo 为 base64(method:password)，AEAD-2022 允许 URL 编码的明文
+	if decoded, err := decodeBase64Loose(userInfo); err == nil && strings.Contains(string(decoded), ":") {
+		userInfo = string(decoded)
+	} else if unescaped, err := url.PathUnescape(userInfo); err == nil {
+		userInfo = unescaped
+	}
+	method, password, ok := strings.Cut(userInfo, ":")
+	if !ok {
+		return fmt.Errorf("ss 链接缺少加密方式或密码")
+	}
+	n.Method, n.Password = strings.ToLower(method), password
+
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return fmt.Errorf("ss 链接服务器地址无效: %w", err)
+	}
+	n.Server = host
+	n.Port, _ = strconv.Atoi(port)
+	return nil
+}
+
+// parseSSR 解析 ssr 链接：base64(host:port:protocol:method:obfs:base64(password)/?params)
+func (n *ProxyNode) parseSSR(body string) error {
+	data, err := decodeBase64Loose(body)
+	if err != nil {
+		return fmt.Errorf("ssr 链接 base64 解码失败")
+	}
+	main, query, _ := strings.Cut(string(data), "/?")
+
+	parts := strings.Split(main, ":")
+	if len(parts) < 6 {
+		return fmt.Errorf("ssr 链接字段不完整")
+	}
+	// 从末尾取固定字段，兼容 IPv6 地址中的冒号
+	count := len(parts)
+	password, err := decodeBase64Loose(parts[count-1])
+	if err != nil {
+		return fmt.Errorf("ssr 密码解码失败")
+	}
+	n.Password = string(password)
+	n.Params["obfs"] = parts[count-2]
+	n.Method = strings.ToLower(parts[count-3])
+	n.Params["protocol"] = parts[count-4]
+	n.Port, _ = strconv.Atoi(parts[count-5])
+	n.Server = strings.Join(parts[:count-5], ":")
+
+	if values, err := url.ParseQuery(query); err == nil {
+		for key, v := range values {
+			decoded, err := decodeBase64Loose(v[0])
+			if err != nil {
+				continue
+			}
+			n.Params[key] = string(decoded)
+		}
+	}
+	n.Name = n.Params["remarks"]
+	return nil
+}
+
+// Credential 返回节点的认证凭据（用于指纹）
+func (n *ProxyNode) Credential() string {
+	switch n.Protocol {
+	case "vmess", "vless":
+		return strings.ToLower(n.UUID)
+	case "ss", "ssr":
+		return n.Method + ":" + n.Password
+	case "tuic", "juicity":
+		return strings.ToLower(n.UUID) + ":" + n.Password
+	}
+	return n.Password
+}
+
+// Fingerprint 返回节点的规范化指纹（协议 + 服务器 + 端口 + 凭据），与备注和参数顺序无关
+func (n *ProxyNode) Fingerprint() string {
+	key := fmt.Sprintf("%s|%s|%d|%s", n.Protocol, n.Server, n.Port, n.Credential())
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// decodeBase64Loose 兼容标准 / URL 安全、带或不带填充的 base64 解码
+func decodeBase64Loose(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	data, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil {
+		data, err = base64.RawURLEncoding.DecodeString(s)
+	}
+	return data, err
+}
+
+// NodeDedup 已提交节点的指纹缓存，避免同一服务器因备注或参数顺序不同被重复提交
+// 通过 Filter 的节点指纹在提交完成前处于占用状态，多个工作协程中的相同节点只有一个会被提交；
+// 提交失败进入发件箱的节点由发件箱继续占用，直到条目送达或被丢弃
+type NodeDedup struct {
+	mu      sync.Mutex
+	seen    map[string]int64 // 指纹 -> 提交时间（Unix 秒）
+	pending map[string]int   // 指纹 -> 占用数（提交中或在发件箱中等待重试，不持久化）
+	ttl     time.Duration
+	dirty   bool
+}
+
+// NewNodeDedup 创建节点指纹缓存
+func NewNodeDedup(ttl time.Duration) *NodeDedup {
+	return &NodeDedup{
+		seen:    make(map[string]int64),
+		pending: make(map[string]int),
+		ttl:     ttl,
+	}
+}
+
+// dedupeNodeLinks 按指纹去除批次内的重复节点，返回 (保留的节点, 跳过的重复数)
+// 无法解析的节点原样保留，交由 API 处理
+func dedupeNodeLinks(nodes []string) ([]string, int) {
+	batch := make(map[string]bool)
+	var kept []string
+	duplicates := 0
+
+	for _, link := range nodes {
+		node, err := ParseProxyNode(link)
+		if err != nil {
+			// fmt.Printf("[DEBUG] 节点解析失败，跳过指纹去重 (link=%s): %v\n", link, err)
+			kept = append(kept, link)
+			continue
+		}
+		fp := node.Fingerprint()
+		if batch[fp] {
+			duplicates++
+			continue
+		}
+		batch[fp] = true
+		kept = append(kept, link)
+	}
+	return kept, duplicates
+}
+
+// Filter 去除批次内重复、近期已提交过以及正在提交的节点，返回 (保留的节点, 跳过的重复数)
+// 保留节点的指纹被占用，调用方在提交后必须 Mark 成功的节点并 Release 全部保留的节点
+func (d *NodeDedup) Filter(nodes []string) ([]string, int) {
+	nodes, duplicates := dedupeNodeLinks(nodes)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().Unix()
+	var kept []string
+	for _, link := range nodes {
+		if node, err := ParseProxyNode(link); err == nil {
+			fp := node.Fingerprint()
+			if ts, ok := d.seen[fp]; (ok && now-ts < int64(d.ttl/time.Second)) || d.pending[fp] > 0 {
+				duplicates++
+				continue
+			}
+			d.pending[fp]++
+		}
+		kept = append(kept, link)
+	}
+	return kept, duplicates
+}
+
+// Mark 记录已成功提交的节点指纹
+func (d *NodeDedup) Mark(nodes []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().Unix()
+	for _, link := range nodes {
+		if node, err := ParseProxyNode(link); err == nil {
+			d.seen[node.Fingerprint()] = now
+			d.dirty = true
+		}
+	}
+}
+
+// Claim 占用节点指纹（发件箱保存或加载节点条目时调用），与 Release 成对使用
+func (d *NodeDedup) Claim(nodes []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, link := range nodes {
+		if node, err := ParseProxyNode(link); err == nil {
+			d.pending[node.Fingerprint()]++
+		}
+	}
+}
+
+// Release 释放 Filter 或 Claim 的占用（已 Mark 的节点仍在有效期内去重），未提交成功的节点之后可以再次通过
+func (d *NodeDedup) Release(nodes []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, link := range nodes {
+		if node, err := ParseProxyNode(link); err == nil {
+			fp := node.Fingerprint()
+			if d.pending[fp] <= 1 {
+				delete(d.pending, fp)
+			} else {
+				d.pending[fp]--
+			}
+		}
+	}
+}
+
+// Forget 移除节点指纹（节点被撤回后再次出现时可以重新提交）
+func (d *NodeDedup) Forget(nodes []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, link := range nodes {
+		if node, err := ParseProxyNode(link); err == nil {
+			if _, ok := d.seen[node.Fingerprint()]; ok {
+				delete(d.seen, node.Fingerprint())
+				d.dirty = true
+			}
+		}
+	}
+}
+
+// Load 从磁盘加载指纹缓存（忽略已过期的条目），返回加载的条目数
+func (d *NodeDedup) Load(filename string) (int, error) {
+	var entries map[string]int64
+	found, err := loadJSONFile(filename, &entries)
+	if err != nil || !found {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().Unix()
+	for fp, ts := range entries {
+		if now-ts < int64(d.ttl/time.Second) {
+			d.seen[fp] = ts
+		}
+	}
+	return len(d.seen), nil
+}
+
+// Save 清理过期条目并写入磁盘，无变更时跳过
+func (d *NodeDedup) Save(filename string) error {
+	d.mu.Lock()
+	if !d.dirty {
+		d.mu.Unlock()
+		return nil
+	}
+	now := time.Now().Unix()
+	entries := make(map[string]int64, len(d.seen))
+	for fp, ts := range d.seen {
+		if now-ts >= int64(d.ttl/time.Second) {
+			delete(d.seen, fp)
+			continue
+		}
+		entries[fp] = ts
+	}
+	d.dirty = false
+	d.mu.Unlock()
+
+	if err := saveJSONFile(filename, entries); err != nil {
+		d.mu.Lock()
+		d.dirty = true
+		d.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// StartAutoSave 定期将指纹缓存写入磁盘，ctx 结束时执行最后一次保存
+func (d *NodeDedup) StartAutoSave(ctx context.Context, filename string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := d.Save(filename); err != nil {
+				fmt.Printf("⚠️  保存节点指纹缓存失败: %v\n", err)
+			}
+			return
+		case <-ticker.C:
+			if err := d.Save(filename); err != nil {
+				fmt.Printf("⚠️  保存节点指纹缓存失败: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// tdl-msgproce - 节点本地连通性探测（TCP 连接 + TLS 握手）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeTimeout     = 5 * time.Second  // 默认单个节点的探测超时
+	defaultProbeConcurrency = 16               // 默认最大并发探测数
+	probeCacheTTL           = 10 * time.Minute // 探测结果缓存时间（同一地址短时间内不重复探测）
+)
+
+// udpProtocols 基于 UDP（QUIC）的协议，无法用 TCP 探测，直接视为可达
+var udpProtocols = map[string]bool{
+	"hysteria":  true,
+	"hysteria2": true,
+	"tuic":      true,
+	"juicity":   true,
+	"wireguard": true,
+}
+
+// ProbeResult 单个节点的探测结果
+type ProbeResult struct {
+	Link      string
+	Reachable bool
+	Skipped   bool          // 协议不支持 TCP 探测或链接无法解析
+	TLS       bool          // 是否进行了 TLS 握手
+	Latency   time.Duration // 连接（含握手）耗时
+	Err       error
+}
+
+// probeTarget 探测目标
+type probeTarget struct {
+	address    string
+	tls        bool
+	serverName string
+}
+
+// probeCacheEntry 缓存的探测结果
+type probeCacheEntry struct {
+	err     error
+	latency time.Duration
+	at      time.Time
+}
+
+// NodeProber 在提交前对节点做 TCP 连接（TLS 类协议再做 TLS 握手），过滤明显不可达的节点
+type NodeProber struct {
+	timeout     time.Duration
+	concurrency int
+
+	mu    sync.Mutex
+	cache map[probeTarget]probeCacheEntry
+}
+
+// NewNodeProber 创建节点探测器
+func NewNodeProber(timeout time.Duration, concurrency int) *NodeProber {
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	if concurrency <= 0 {
+		concurrency = defaultProbeConcurrency
+	}
+	return &NodeProber{
+		timeout:     timeout,
+		concurrency: concurrency,
+		cache:       make(map[probeTarget]probeCacheEntry),
+	}
+}
+
+// nodeProbeTarget 根据节点协议和参数确定探测地址及是否需要 TLS 握手
+func nodeProbeTarget(node *ProxyNode) (probeTarget, bool) {
+	if udpProtocols[node.Protocol] || node.Server == "" || node.Port <= 0 {
+		return probeTarget{}, false
+	}
+
+	target := probeTarget{address: net.JoinHostPort(node.Server, strconv.Itoa(node.Port))}
+	p := node.Params
+	switch node.Protocol {
+	case "trojan", "anytls":
+		target.tls = true
+	case "vless":
+		// reality 握手依赖客户端密钥，只做 TCP 连接
+		target.tls = p["security"] == "tls"
+	case "vmess":
+		target.tls = p["tls"] == "tls"
+	}
+	if target.tls {
+		target.serverName = firstNonEmpty(p["sni"], p["peer"], p["host"], node.Server)
+	}
+	return target, true
+}
+
+// Probe 并发探测节点，返回按原顺序排列的探测结果
+func (np *NodeProber) Probe(ctx context.Context, links []string) []ProbeResult {
+	results := make([]ProbeResult, len(links))
+	sem := make(chan struct{}, np.concurrency)
+	var wg sync.WaitGroup
+
+	for i, link := range links {
+		results[i].Link = link
+		node, err := ParseProxyNode(link)
+		if err != nil {
+			results[i].Reachable, results[i].Skipped = true, true
+			continue
+		}
+		target, ok := nodeProbeTarget(node)
+		if !ok {
+			results[i].Reachable, results[i].Skipped = true, true
+			continue
+		}
+
+		wg.Add(1)
+		go func(r *ProbeResult, target probeTarget) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				// 探测被取消时不过滤节点
+				r.Reachable, r.Skipped, r.Err = true, true, ctx.Err()
+				return
+			}
+			r.TLS = target.tls
+			r.Latency, r.Err = np.probe(ctx, target)
+			r.Reachable = r.Err == nil
+			if r.Err != nil && ctx.Err() != nil {
+				// 探测中途被取消，结果不可信
+				r.Reachable, r.Skipped = true, true
+			}
+		}(&results[i], target)
+	}
+	wg.Wait()
+	return results
+}
+
+// probe 探测单个地址（优先使用缓存）
+func (np *NodeProber) probe(ctx context.Context, target probeTarget) (time.Duration, error) {
+	np.mu.Lock()
+	if entry, ok := np.cache[target]; ok && time.Since(entry.at) < probeCacheTTL {
+		np.mu.Unlock()
+		return entry.latency, entry.err
+	}
+	np.mu.Unlock()
+
+	latency, err := np.dial(ctx, target)
+	if ctx.Err() != nil {
+		// 取消导致的失败不缓存
+		return latency, err
+	}
+
+	np.mu.Lock()
+	np.cache[target] = probeCacheEntry{err: err, latency: latency, at: time.Now()}
+	for key, entry := range np.cache {
+		if time.Since(entry.at) >= probeCacheTTL {
+			delete(np.cache, key)
+		}
+	}
+	np.mu.Unlock()
+	return latency, err
+}
+
+// dial 建立 TCP 连接，需要时完成 TLS 握手（不校验证书，只判断可达）
+func (np *NodeProber) dial(ctx context.Context, target probeTarget) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, np.timeout)
+	defer cancel()
+
+	start := time.Now()
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", target.address)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if target.tls {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: target.serverName, InsecureSkipVerify: true})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return 0, fmt.Errorf("TLS 握手失败: %w", err)
+		}
+	}
+	return time.Since(start), nil
+}
+
+// probeNodes 探测节点连通性并过滤不可达的节点（未启用探测时原样返回）
+// channelID 为 0 时不计入频道统计
+func (p *MessageProcessor) probeNodes(ctx context.Context, nodes []string, channelID int64, label string) []string {
+	if p.prober == nil || len(nodes) == 0 {
+		return nodes
+	}
+
+	start := time.Now()
+	results := p.prober.Probe(ctx, nodes)
+	reachable := make([]string, 0, len(nodes))
+	skipped := 0
+	for _, r := range results {
+		if r.Skipped {
+			skipped++
+		}
+		if r.Reachable {
+			reachable = append(reachable, r.Link)
+			// fmt.Printf("[DEBUG] 节点可达 (tls=%v, 耗时=%v): %.80s\n", r.TLS, r.Latency, r.Link)
+			continue
+		}
+		fmt.Printf("📵 %s节点不可达: %v (%.80s)\n", label, r.Err, r.Link)
+	}
+
+	unreachable := len(nodes) - len(reachable)
+	if channelID != 0 {
+		p.stats.Update(channelID, func(s *ChannelStats) {
+			s.Probed += int64(len(nodes) - skipped)
+			s.Unreachable += int64(unreachable)
+		})
+	}
+	fmt.Printf("📡 %s节点探测完成: 可达 %d, 不可达 %d, 未探测 %d (耗时 %v)\n",
+		label, len(reachable)-skipped, unreachable, skipped, time.Since(start).Round(time.Millisecond))
+	return reachable
+}
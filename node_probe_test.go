@@ -0,0 +1,167 @@
+// tdl-msgproce - 节点连通性探测测试
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenTCP 启动本地 TCP 监听，handle 处理每个连接（nil 表示接受后保持连接不响应）
+func listenTCP(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if handle == nil {
+				t.Cleanup(func() { conn.Close() })
+				continue
+			}
+			handle(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// closedAddr 返回一个没有监听的本地地址（连接会被拒绝）
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestNodeProberProbe(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer tlsServer.Close()
+	tlsAddr := strings.TrimPrefix(tlsServer.URL, "https://")
+
+	plainAddr := listenTCP(t, func(conn net.Conn) { conn.Close() })
+	silentAddr := listenTCP(t, nil)
+	refusedAddr := closedAddr(t)
+
+	tests := []struct {
+		name      string
+		link      string
+		reachable bool
+		skipped   bool
+		tls       bool
+		errText   string
+	}{
+		{"TCP 可达", "vless://b831381d-6324-4d53-ad4f-8cda48b30811@" + plainAddr + "?security=reality", true, false, false, ""},
+		{"TLS 握手成功", "trojan://pw@" + tlsAddr + "?sni=example.com", true, false, true, ""},
+		{"连接被拒绝", "trojan://pw@" + refusedAddr, false, false, true, "refused"},
+		{"TLS 握手失败", "trojan://pw@" + plainAddr, false, false, true, "TLS 握手失败"},
+		{"握手超时", "anytls://pw@" + silentAddr, false, false, true, "TLS 握手失败"},
+		{"hysteria2 不探测", "hysteria2://pw@" + refusedAddr, true, true, false, ""},
+		{"tuic 不探测", "tuic://b831381d-6324-4d53-ad4f-8cda48b30811:pw@" + refusedAddr, true, true, false, ""},
+		{"无法解析的链接不探测", "trojan://pw@", true, true, false, ""},
+	}
+
+	np := NewNodeProber(300*time.Millisecond, 4)
+	links := make([]string, len(tests))
+	for i, tt := range tests {
+		links[i] = tt.link
+	}
+	results := np.Probe(context.Background(), links)
+	if len(results) != len(tests) {
+		t.Fatalf("Probe 返回 %d 个结果, want %d", len(results), len(tests))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := results[i]
+			if r.Link != tt.link {
+				t.Fatalf("结果顺序错误: Link = %q, want %q", r.Link, tt.link)
+			}
+			if r.Reachable != tt.reachable || r.Skipped != tt.skipped || r.TLS != tt.tls {
+				t.Errorf("Reachable=%v Skipped=%v TLS=%v, want %v %v %v (err=%v)",
+					r.Reachable, r.Skipped, r.TLS, tt.reachable, tt.skipped, tt.tls, r.Err)
+			}
+			if tt.errText != "" && (r.Err == nil || !strings.Contains(r.Err.Error(), tt.errText)) {
+				t.Errorf("Err = %v, want containing %q", r.Err, tt.errText)
+			}
+		})
+	}
+}
+
+func TestNodeProberCache(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	np := NewNodeProber(time.Second, 1)
+	target := probeTarget{address: ln.Addr().String()}
+	if _, err := np.probe(context.Background(), target); err != nil {
+		t.Fatalf("首次探测失败: %v", err)
+	}
+
+	// 关闭监听后，缓存有效期内仍返回缓存的结果
+	ln.Close()
+	if _, err := np.probe(context.Background(), target); err != nil {
+		t.Errorf("缓存有效期内重新探测了地址: %v", err)
+	}
+
+	// 缓存过期后重新探测
+	np.mu.Lock()
+	entry := np.cache[target]
+	entry.at = time.Now().Add(-probeCacheTTL)
+	np.cache[target] = entry
+	np.mu.Unlock()
+	if _, err := np.probe(context.Background(), target); err == nil {
+		t.Errorf("缓存过期后没有重新探测")
+	}
+}
+
+func TestNodeProberCancelNotCached(t *testing.T) {
+	np := NewNodeProber(5*time.Second, 1)
+	target := probeTarget{address: listenTCP(t, nil), tls: true, serverName: "example.com"}
+
+	// 握手进行中取消
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := np.probe(ctx, target); err == nil {
+		t.Fatalf("取消的探测返回成功")
+	}
+
+	// 探测开始前已取消
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := np.Probe(cancelled, []string{"trojan://pw@" + closedAddr(t)})
+	if !results[0].Reachable {
+		t.Errorf("取消的探测过滤了节点: %+v", results[0])
+	}
+
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	if len(np.cache) != 0 {
+		t.Errorf("取消的探测结果被缓存: %v", np.cache)
+	}
+}
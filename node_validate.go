@@ -0,0 +1,111 @@
+// tdl-msgproce - 节点链接校验与修复
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// trailingJunkChars 链接末尾常见的多余字符（Markdown 标记、标点等）
+const trailingJunkChars = ".,;:!?'\"`*>|]}"
+
+// requiredNodeFields 各协议必需的认证字段，未列出的协议只修剪不校验
+var requiredNodeFields = map[string]string{
+	"vmess":     "uuid",
+	"vless":     "uuid",
+	"tuic":      "uuid",
+	"juicity":   "uuid",
+	"trojan":    "password",
+	"ss":        "password",
+	"ssr":       "password",
+	"hysteria2": "password",
+	"anytls":    "password",
+	"hysteria":  "",
+}
+
+// rejectedNode 校验失败的节点
+type rejectedNode struct {
+	Link   string
+	Reason string
+}
+
+// trimNodeLink 去除正则贪婪匹配带入的末尾多余字符
+// 不平衡的右括号（Markdown 链接）和标点总是去除；链接没有备注（#）时，末尾的 emoji 等非 ASCII 字符也去除
+func trimNodeLink(link string) string {
+	hasFragment := strings.Contains(link, "#")
+	for link != "" {
+		r, size := utf8.DecodeLastRuneInString(link)
+		switch {
+		case r == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+		case strings.ContainsRune(trailingJunkChars, r):
+		case r >= utf8.RuneSelf && !hasFragment:
+		default:
+			return link
+		}
+		link = link[:len(link)-size]
+	}
+	return link
+}
+
+// validateNodeLink 修剪并校验单个节点链接，返回 (修复后的链接, 失败原因)，原因为空表示有效
+func validateNodeLink(link string) (string, string) {
+	fixed := trimNodeLink(link)
+	if !strings.Contains(fixed, "://") {
+		return fixed, "链接不完整"
+	}
+
+	protocol := strings.ToLower(fixed[:strings.Index(fixed, "://")])
+	if alias, ok := protocolAliases[protocol]; ok {
+		protocol = alias
+	}
+	required, known := requiredNodeFields[protocol]
+	if !known {
+		return fixed, ""
+	}
+
+	node, err := ParseProxyNode(fixed)
+	if err != nil {
+		return fixed, err.Error()
+	}
+
+	switch required {
+	case "uuid":
+		if node.UUID == "" {
+			return fixed, "缺少 UUID"
+		}
+	case "password":
+		if node.Password == "" {
+			return fixed, "缺少密码"
+		}
+	}
+	if (protocol == "ss" || protocol == "ssr") && node.Method == "" {
+		return fixed, "缺少加密方式"
+	}
+	return fixed, ""
+}
+
+// validateNodeLinks 批量校验节点链接，返回 (有效链接, 被修复的数量, 被丢弃的链接)
+func validateNodeLinks(nodes []string) ([]string, int, []rejectedNode) {
+	var valid []string
+	var rejected []rejectedNode
+	repaired := 0
+
+	for _, link := range nodes {
+		fixed, reason := validateNodeLink(link)
+		if reason != "" {
+			rejected = append(rejected, rejectedNode{Link: link, Reason: reason})
+			continue
+		}
+		if fixed != link {
+			repaired++
+			// fmt.Printf("[DEBUG] 节点链接已修复 (原始=%s, 修复后=%s)\n", link, fixed)
+		}
+		valid = append(valid, fixed)
+	}
+	return valid, repaired, rejected
+}
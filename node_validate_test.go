@@ -0,0 +1,59 @@
+// tdl-msgproce - 节点链接校验与修复测试
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestValidateNodeLink(t *testing.T) {
+	ssUserInfo := base64.RawURLEncoding.EncodeToString([]byte("aes-256-gcm:pw"))
+	tests := []struct {
+		name   string
+		link   string
+		want   string
+		reason string
+	}{
+		{"有效链接不变", "trojan://pw@a.com:443#节点", "trojan://pw@a.com:443#节点", ""},
+		{"末尾标点", "trojan://pw@a.com:443.", "trojan://pw@a.com:443", ""},
+		{"Markdown 粗体和括号", "trojan://pw@a.com:443**)", "trojan://pw@a.com:443", ""},
+		{"平衡的括号保留", "trojan://pw@a.com:443#香港(IPLC)", "trojan://pw@a.com:443#香港(IPLC)", ""},
+		{"无备注时去除末尾 emoji", "trojan://pw@a.com:443🚀", "trojan://pw@a.com:443", ""},
+		{"备注中的 emoji 保留", "trojan://pw@a.com:443#🇭🇰", "trojan://pw@a.com:443#🇭🇰", ""},
+		{"备注后的标点", "vless://b831381d-6324-4d53-ad4f-8cda48b30811@a.com:443?type=ws#HK\",", "vless://b831381d-6324-4d53-ad4f-8cda48b30811@a.com:443?type=ws#HK", ""},
+		{"ss 修复后有效", "ss://" + ssUserInfo + "@a.com:8388`", "ss://" + ssUserInfo + "@a.com:8388", ""},
+		{"未知协议只修剪", "snell://a.com:443>", "snell://a.com:443", ""},
+		{"修剪后不完整", "trojan:.", "trojan", "链接不完整"},
+		{"缺少服务器", "trojan://", "trojan://", "缺少服务器地址"},
+		{"vless 缺少 UUID", "vless://@a.com:443", "vless://@a.com:443", "缺少 UUID"},
+		{"trojan 缺少密码", "trojan://a.com:443", "trojan://a.com:443", "缺少密码"},
+		{"hy2 别名缺少密码", "hy2://a.com:443", "hy2://a.com:443", "缺少密码"},
+		{"ss 缺少加密方式", "ss://" + base64.RawURLEncoding.EncodeToString([]byte(":pw")) + "@a.com:8388", "ss://" + base64.RawURLEncoding.EncodeToString([]byte(":pw")) + "@a.com:8388", "缺少加密方式"},
+		{"端口无效", "trojan://pw@a.com", "trojan://pw@a.com", "端口无效"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := validateNodeLink(tt.link)
+			if got != tt.want || reason != tt.reason {
+				t.Errorf("validateNodeLink(%q) = (%q, %q), want (%q, %q)", tt.link, got, reason, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestValidateNodeLinks(t *testing.T) {
+	valid, repaired, rejected := validateNodeLinks([]string{
+		"trojan://pw@a.com:443",
+		"trojan://pw@b.com:443).",
+		"vless://@c.com:443",
+	})
+	if len(valid) != 2 || valid[1] != "trojan://pw@b.com:443" {
+		t.Errorf("valid = %v", valid)
+	}
+	if repaired != 1 {
+		t.Errorf("repaired = %d, want 1", repaired)
+	}
+	if len(rejected) != 1 || rejected[0].Link != "vless://@c.com:443" || rejected[0].Reason != "缺少 UUID" {
+		t.Errorf("rejected = %+v", rejected)
+	}
+}
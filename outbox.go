@@ -0,0 +1,368 @@
+// tdl-msgproce - 提交失败的持久化发件箱与后台重试
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	outboxRetryInterval = 1 * time.Minute // 后台重试间隔
+	outboxMaxEntries    = 5000            // 发件箱最大条目数，超出时丢弃最早的条目
+)
+
+// OutboxEntry 一次提交失败的记录（单个订阅或一批节点）
+type OutboxEntry struct {
+	ID        int64    `json:"id"`
+	Sink      string   `json:"sink"`       // 输出目标名称（为空表示订阅 API）
+	Links     []string `json:"links"`      // 订阅链接（1 个）或批量节点
+	IsNode    bool     `json:"is_node"`    // 是否为节点批次
+	ChannelID int64    `json:"channel_id"` // 来源频道
+	MessageID int      `json:"message_id"` // 来源消息
+	Attempts  int      `json:"attempts"`   // 发件箱重试次数（不含首次提交）
+	LastError string   `json:"last_error"` // 最近一次失败原因
+	CreatedAt int64    `json:"created_at"` // 加入时间（Unix 秒）
+}
+
+// Outbox 订阅 API 暂时不可用时保存失败的提交，API 恢复后由后台重试
+// 每次变更立即写入磁盘，避免进程退出或崩溃时丢失
+type Outbox struct {
+	mu       sync.Mutex
+	path     string
+	entries  []OutboxEntry
+	nextID   int64
+	flushing sync.Mutex // 同一时间只允许一次重试
+}
+
+// NewOutbox 创建发件箱
+func NewOutbox(path string) *Outbox {
+	return &Outbox{path: path, nextID: 1}
+}
+
+// Load 从磁盘加载发件箱，返回条目数
+func (o *Outbox) Load() (int, error) {
+	var entries []OutboxEntry
+	found, err := loadJSONFile(o.path, &entries)
+	if err != nil || !found {
+		return 0, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.entries = entries
+	for _, e := range entries {
+		if e.ID >= o.nextID {
+			o.nextID = e.ID + 1
+		}
+	}
+	return len(o.entries), nil
+}
+
+// saveLocked 写入磁盘（调用方持有 o.mu）
+func (o *Outbox) saveLocked() {
+	if err := saveJSONFile(o.path, o.entries); err != nil {
+		fmt.Printf("⚠️  保存发件箱失败: %v\n", err)
+	}
+}
+
+// Add 加入一条失败的提交，返回因发件箱已满被丢弃的条目
+func (o *Outbox) Add(entry OutboxEntry) []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry.ID = o.nextID
+	o.nextID++
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = time.Now().Unix()
+	}
+	o.entries = append(o.entries, entry)
+	var dropped []OutboxEntry
+	if len(o.entries) > outboxMaxEntries {
+		n := len(o.entries) - outboxMaxEntries
+		fmt.Printf("⚠️  发件箱已满，丢弃最早的 %d 条记录\n", n)
+		dropped = append(dropped, o.entries[:n]...)
+		o.entries = append([]OutboxEntry(nil), o.entries[n:]...)
+	}
+	o.saveLocked()
+	return dropped
+}
+
+// Len 返回条目数和链接总数
+func (o *Outbox) Len() (int, int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	links := 0
+	for _, e := range o.entries {
+		links += len(e.Links)
+	}
+	return len(o.entries), links
+}
+
+// Oldest 返回最早的条目
+func (o *Outbox) Oldest() (OutboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.entries) == 0 {
+		return OutboxEntry{}, false
+	}
+	return o.entries[0], true
+}
+
+// Purge 清空发件箱，返回清除的条目
+func (o *Outbox) Purge() []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	purged := o.entries
+	o.entries = nil
+	o.saveLocked()
+	return purged
+}
+
+// snapshot 返回条目副本
+func (o *Outbox) snapshot() []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]OutboxEntry(nil), o.entries...)
+}
+
+// remove 删除指定条目
+func (o *Outbox) remove(id int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i, e := range o.entries {
+		if e.ID == id {
+			o.entries = append(o.entries[:i], o.entries[i+1:]...)
+			o.saveLocked()
+			return
+		}
+	}
+}
+
+// recordFailure 更新条目的重试次数和失败原因，部分送达时只保留未送达的链接
+func (o *Outbox) recordFailure(id int64, err error, undelivered []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.entries {
+		if o.entries[i].ID == id {
+			o.entries[i].Attempts++
+			o.entries[i].LastError = err.Error()
+			if len(undelivered) > 0 {
+				o.entries[i].Links = undelivered
+			}
+			o.saveLocked()
+			return
+		}
+	}
+}
+
+// saveToOutbox 将暂时性失败（网络错误、超时、5xx）的提交加入发件箱，被 API 拒绝的提交不保存
+func (p *MessageProcessor) saveToOutbox(sinkName string, result *SubmitResult, err error, links []string, isNode bool, channelID int64, messageID int) {
+	if result == nil || !result.Retryable() {
+		return
+	}
+	entry := OutboxEntry{
+		Sink:      sinkName,
+		Links:     links,
+		IsNode:    isNode,
+		ChannelID: channelID,
+		MessageID: messageID,
+		LastError: err.Error(),
+	}
+	// 节点在发件箱中等待重试期间保持指纹占用，避免被其他消息重复提交
+	p.claimOutboxNodes(entry)
+	p.releaseOutboxNodes(p.outbox.Add(entry)...)
+	entries, _ := p.outbox.Len()
+	fmt.Printf("📮 已保存到发件箱，恢复后自动重试 (输出=%s, 频道=%d, 消息ID=%d, 链接数=%d, 待重试=%d)\n", sinkName, channelID, messageID, len(links), entries)
+}
+
+// claimOutboxNodes 占用发件箱节点条目的指纹（保存条目或启动加载发件箱时调用）
+func (p *MessageProcessor) claimOutboxNodes(entries ...OutboxEntry) {
+	for _, e := range entries {
+		if e.IsNode {
+			p.nodeDedup.Claim(e.Links)
+		}
+	}
+}
+
+// releaseOutboxNodes 释放发件箱节点条目的指纹占用（条目送达、被拒绝或丢弃时调用）
+func (p *MessageProcessor) releaseOutboxNodes(entries ...OutboxEntry) {
+	for _, e := range entries {
+		if e.IsNode {
+			p.nodeDedup.Release(e.Links)
+		}
+	}
+}
+
+// undeliveredItems 部分送达时只保留未送达的提交项
+func undeliveredItems(items []sinkItem, result *SubmitResult) []sinkItem {
+	if result == nil || len(result.Undelivered) == 0 {
+		return items
+	}
+	pending := make(map[string]bool, len(result.Undelivered))
+	for _, link := range result.Undelivered {
+		pending[link] = true
+	}
+	var kept []sinkItem
+	for _, item := range items {
+		if pending[item.Link] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// saveItemsToOutbox 按来源消息拆分提交项后分别加入发件箱
+func (p *MessageProcessor) saveItemsToOutbox(sinkName string, result *SubmitResult, err error, items []sinkItem, isNode bool) {
+	type source struct {
+		channelID int64
+		messageID int
+	}
+	var order []source
+	groups := make(map[source][]string)
+	for _, item := range items {
+		key := source{item.ChannelID, item.MessageID}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], item.Link)
+	}
+	for _, key := range order {
+		p.saveToOutbox(sinkName, result, err, groups[key], isNode, key.channelID, key.messageID)
+	}
+}
+
+// flushOutbox 按加入顺序重新提交发件箱中的条目；某个输出目标出现暂时性失败后（仍不可用），
+// 本轮跳过该目标的剩余条目，其他输出目标的条目继续重试
+// 返回 (成功数, 被拒绝丢弃数, 剩余条目数, 最后一次暂时性失败)
+func (p *MessageProcessor) flushOutbox(ctx context.Context) (int, int, int, error) {
+	p.outbox.flushing.Lock()
+	defer p.outbox.flushing.Unlock()
+
+	sent, dropped := 0, 0
+	var lastErr error
+	failedSinks := make(map[string]bool) // 本轮出现暂时性失败的输出目标
+	for _, entry := range p.outbox.snapshot() {
+		if ctx.Err() != nil {
+			lastErr = ctx.Err()
+			break
+		}
+
+		sinkName := entry.Sink
+		if sinkName == "" {
+			sinkName = defaultSink
+		}
+		sink, ok := p.sinks.Get(sinkName)
+		if !ok {
+			p.outbox.remove(entry.ID)
+			p.releaseOutboxNodes(entry)
+			dropped++
+			fmt.Printf("🚫 发件箱条目的输出目标 %s 已不存在，已丢弃 (频道=%d, 消息ID=%d)\n", sinkName, entry.ChannelID, entry.MessageID)
+			continue
+		}
+		if failedSinks[sinkName] {
+			continue
+		}
+
+		result, err := sink.Submit(ctx, entry.Links, entry.IsNode)
+		p.sinks.record(sinkName, result.OK(), len(entry.Links))
+		if !result.OK() && result.Retryable() {
+			p.outbox.recordFailure(entry.ID, err, result.Undelivered)
+			if entry.IsNode && len(result.Undelivered) > 0 {
+				// 部分送达：已发出的节点记录指纹并释放占用，条目只保留未送达的节点
+				sentLinks := linksExcept(entry.Links, result.Undelivered)
+				p.nodeDedup.Mark(sentLinks)
+				p.nodeDedup.Release(sentLinks)
+			}
+			lastErr = err
+			failedSinks[sinkName] = true
+			continue
+		}
+
+		p.outbox.remove(entry.ID)
+		p.releaseOutboxNodes(entry)
+		if !result.OK() {
+			dropped++
+			fmt.Printf("🚫 发件箱条目被 %s 拒绝，已丢弃 (频道=%d, 消息ID=%d): %v\n", sinkName, entry.ChannelID, entry.MessageID, err)
+			continue
+		}
+
+		sent++
+		if entry.IsNode {
+			p.nodeDedup.Mark(entry.Links)
+			p.stats.Update(entry.ChannelID, func(s *ChannelStats) { s.Nodes += int64(len(entry.Links)) })
+		} else {
+			p.stats.Update(entry.ChannelID, func(s *ChannelStats) { s.Subscriptions++ })
+		}
+		fmt.Printf("📮 发件箱重试成功 (输出=%s, 频道=%d, 消息ID=%d, 链接数=%d, 重试次数=%d)\n", sinkName, entry.ChannelID, entry.MessageID, len(entry.Links), entry.Attempts+1)
+	}
+
+	remaining, _ := p.outbox.Len()
+	return sent, dropped, remaining, lastErr
+}
+
+// linksExcept 返回 links 中不在 excluded 里的链接
+func linksExcept(links []string, excluded []string) []string {
+	skip := make(map[string]bool, len(excluded))
+	for _, link := range excluded {
+		skip[link] = true
+	}
+	var kept []string
+	for _, link := range links {
+		if !skip[link] {
+			kept = append(kept, link)
+		}
+	}
+	return kept
+}
+
+// StartOutboxRetrier 定期重试发件箱中的提交，直到 ctx 结束
+func (p *MessageProcessor) StartOutboxRetrier(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if entries, _ := p.outbox.Len(); entries == 0 {
+				continue
+			}
+			sent, dropped, remaining, _ := p.flushOutbox(ctx)
+			if sent > 0 || dropped > 0 {
+				fmt.Printf("📮 发件箱重试完成: 成功 %d, 丢弃 %d, 剩余 %d\n", sent, dropped, remaining)
+			}
+			// fmt.Printf("[DEBUG] 发件箱剩余 %d 条，等待下次重试\n", remaining)
+		}
+	}
+}
+
+// formatOutboxStatus 发件箱状态文本（用于 Bot）
+func (p *MessageProcessor) formatOutboxStatus() string {
+	entries, links := p.outbox.Len()
+	if entries == 0 {
+		return "📮 发件箱: 空"
+	}
+	status := fmt.Sprintf("📮 发件箱: %d 条 (%d 个链接)", entries, links)
+	if oldest, ok := p.outbox.Oldest(); ok {
+		status += fmt.Sprintf("\n• 最早: %s (频道 %d, 消息 %d)",
+			time.Unix(oldest.CreatedAt, 0).Format("2006-01-02 15:04:05"), oldest.ChannelID, oldest.MessageID)
+		if oldest.LastError != "" {
+			status += fmt.Sprintf("\n• 最近错误: %.200s", oldest.LastError)
+		}
+	}
+	return status
+}
@@ -0,0 +1,162 @@
+// tdl-msgproce - 发件箱测试
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeSink 按 status 返回提交结果的输出目标，记录每次提交的链接
+type fakeSink struct {
+	sinkBase
+	status    SubmitStatus
+	submitted [][]string
+}
+
+func (s *fakeSink) Submit(ctx context.Context, links []string, isNode bool) (*SubmitResult, error) {
+	s.submitted = append(s.submitted, links)
+	result := &SubmitResult{Status: s.status, Attempts: 1}
+	switch s.status {
+	case SubmitFailed:
+		return result, errors.New("503 Service Unavailable")
+	case SubmitRejected:
+		return result, errors.New("400 Bad Request")
+	}
+	return result, nil
+}
+
+// newTestOutboxProcessor 创建使用临时发件箱的处理器，sinks 为已注册的输出目标
+func newTestOutboxProcessor(t *testing.T, sinks ...Sink) *MessageProcessor {
+	t.Helper()
+	r := &SinkRegistry{byName: make(map[string]Sink), stats: make(map[string]*SinkStats)}
+	for _, sink := range sinks {
+		r.add(sink)
+	}
+	return &MessageProcessor{
+		config:    &Config{},
+		sinks:     r,
+		stats:     NewChannelStatsTracker(),
+		nodeDedup: NewNodeDedup(time.Hour),
+		outbox:    NewOutbox(filepath.Join(t.TempDir(), "outbox.json")),
+	}
+}
+
+func TestOutboxKeepsNodeClaims(t *testing.T) {
+	p := newTestOutboxProcessor(t)
+	node := "trojan://pw@a.com:443#A"
+
+	kept, _ := p.nodeDedup.Filter([]string{node})
+	failed := &SubmitResult{Status: SubmitFailed, Attempts: 3}
+	p.saveToOutbox("backup", failed, errors.New("timeout"), kept, true, 1001, 1)
+	p.nodeDedup.Release(kept)
+
+	if kept, _ := p.nodeDedup.Filter([]string{"trojan://pw@a.com:443#B"}); len(kept) != 0 {
+		t.Fatalf("发件箱中的节点再次通过去重: %v", kept)
+	}
+
+	// 输出目标已不存在，条目被丢弃后释放占用
+	if _, dropped, remaining, _ := p.flushOutbox(context.Background()); dropped != 1 || remaining != 0 {
+		t.Fatalf("flushOutbox dropped=%d remaining=%d, want 1 0", dropped, remaining)
+	}
+	if kept, _ := p.nodeDedup.Filter([]string{node}); len(kept) != 1 {
+		t.Errorf("条目丢弃后节点仍被占用")
+	}
+}
+
+func TestOutboxPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	o := NewOutbox(path)
+	o.Add(OutboxEntry{Sink: "api", Links: []string{"https://a.com/sub"}, ChannelID: 1001, MessageID: 1})
+	o.Add(OutboxEntry{Sink: "api", Links: []string{"https://b.com/sub"}, ChannelID: 1001, MessageID: 2})
+	o.Add(OutboxEntry{Sink: "backup", Links: []string{"trojan://pw@a.com:443", "vmess://x"}, IsNode: true, ChannelID: 1002, MessageID: 3})
+	o.remove(1)
+	o.recordFailure(3, errors.New("timeout"), []string{"vmess://x"})
+
+	// 每次变更立即写盘，重新加载后内容一致
+	loaded := NewOutbox(path)
+	if n, err := loaded.Load(); err != nil || n != 2 {
+		t.Fatalf("Load = %d, %v; want 2", n, err)
+	}
+	entries := loaded.snapshot()
+	if entries[0].ID != 2 || entries[1].ID != 3 {
+		t.Fatalf("IDs = %d %d, want 2 3", entries[0].ID, entries[1].ID)
+	}
+	node := entries[1]
+	if node.Attempts != 1 || node.LastError != "timeout" || !reflect.DeepEqual(node.Links, []string{"vmess://x"}) || !node.IsNode {
+		t.Errorf("节点条目 = %+v", node)
+	}
+	if entries, links := loaded.Len(); entries != 2 || links != 2 {
+		t.Errorf("Len = %d, %d; want 2, 2", entries, links)
+	}
+
+	// 新条目的 ID 接在已加载的最大 ID 之后
+	loaded.Add(OutboxEntry{Sink: "api", Links: []string{"https://c.com/sub"}})
+	if entries := loaded.snapshot(); entries[2].ID != 4 {
+		t.Errorf("新条目 ID = %d, want 4", entries[2].ID)
+	}
+}
+
+func TestFlushOutboxRetry(t *testing.T) {
+	api := &fakeSink{sinkBase: sinkBase{name: defaultSink}, status: SubmitFailed}
+	p := newTestOutboxProcessor(t, api)
+	failed := &SubmitResult{Status: SubmitFailed, Attempts: 3}
+	p.saveToOutbox("", failed, errors.New("timeout"), []string{"https://a.com/sub"}, false, 1001, 1)
+
+	// 被拒绝的提交不保存
+	p.saveToOutbox("", &SubmitResult{Status: SubmitRejected, Attempts: 1}, errors.New("400"), []string{"https://b.com/sub"}, false, 1001, 2)
+
+	// API 仍不可用：条目保留，每轮重试次数加一
+	for round := 1; round <= 2; round++ {
+		sent, dropped, remaining, err := p.flushOutbox(context.Background())
+		if sent != 0 || dropped != 0 || remaining != 1 || err == nil {
+			t.Fatalf("第 %d 轮: sent=%d dropped=%d remaining=%d err=%v", round, sent, dropped, remaining, err)
+		}
+		if oldest, _ := p.outbox.Oldest(); oldest.Attempts != round || oldest.LastError != "503 Service Unavailable" {
+			t.Fatalf("第 %d 轮: Attempts=%d LastError=%q", round, oldest.Attempts, oldest.LastError)
+		}
+	}
+
+	// API 恢复后提交成功并移出发件箱
+	api.status = SubmitAdded
+	sent, dropped, remaining, err := p.flushOutbox(context.Background())
+	if sent != 1 || dropped != 0 || remaining != 0 || err != nil {
+		t.Fatalf("恢复后: sent=%d dropped=%d remaining=%d err=%v", sent, dropped, remaining, err)
+	}
+	if len(api.submitted) != 3 {
+		t.Errorf("提交了 %d 次, want 3", len(api.submitted))
+	}
+	if stats := p.stats.Snapshot()[1001]; stats.Subscriptions != 1 {
+		t.Errorf("Subscriptions = %d, want 1", stats.Subscriptions)
+	}
+}
+
+func TestFlushOutboxSkipsFailedSink(t *testing.T) {
+	down := &fakeSink{sinkBase: sinkBase{name: "backup"}, status: SubmitFailed}
+	up := &fakeSink{sinkBase: sinkBase{name: "archive"}, status: SubmitAdded}
+	strict := &fakeSink{sinkBase: sinkBase{name: "strict"}, status: SubmitRejected}
+	p := newTestOutboxProcessor(t, down, up, strict)
+
+	failed := &SubmitResult{Status: SubmitFailed, Attempts: 1}
+	err := errors.New("timeout")
+	p.saveToOutbox("backup", failed, err, []string{"https://a.com/sub"}, false, 1001, 1)
+	p.saveToOutbox("archive", failed, err, []string{"https://b.com/sub"}, false, 1001, 2)
+	p.saveToOutbox("backup", failed, err, []string{"https://c.com/sub"}, false, 1001, 3)
+	p.saveToOutbox("strict", failed, err, []string{"https://d.com/sub"}, false, 1001, 4)
+
+	sent, dropped, remaining, lastErr := p.flushOutbox(context.Background())
+	if sent != 1 || dropped != 1 || remaining != 2 || lastErr == nil {
+		t.Fatalf("sent=%d dropped=%d remaining=%d err=%v, want 1 1 2 非空", sent, dropped, remaining, lastErr)
+	}
+	// backup 首个条目失败后本轮跳过其剩余条目，其他输出目标继续重试
+	if len(down.submitted) != 1 || len(up.submitted) != 1 || len(strict.submitted) != 1 {
+		t.Errorf("提交次数 backup=%d archive=%d strict=%d, want 1 1 1", len(down.submitted), len(up.submitted), len(strict.submitted))
+	}
+	entries := p.outbox.snapshot()
+	if entries[0].MessageID != 1 || entries[0].Attempts != 1 || entries[1].MessageID != 3 || entries[1].Attempts != 0 {
+		t.Errorf("剩余条目 = %+v", entries)
+	}
+}
@@ -0,0 +1,689 @@
+// tdl-msgproce - 统一的对等体（频道/群组/用户）解析与 AccessHash 缓存
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	peerKindChannel = "channel" // 频道/超级群组
+	peerKindChat    = "chat"    // 普通群组
+	peerKindUser    = "user"    // 用户/机器人
+
+	dialogsPageSize    = 100              // 单次获取对话数量
+	dialogsMaxPages    = 200              // 最多翻页次数，防止无限循环
+	dialogsScanMinWait = 30 * time.Second // 两次完整对话扫描的最小间隔
+)
+
+// ResolvedPeer 解析后的对等体信息
+type ResolvedPeer struct {
+	Kind       string `json:"kind"` // channel / chat / user
+	ID         int64  `json:"id"`
+	AccessHash int64  `json:"access_hash"`
+	Title      string `json:"title"`
+	Username   string `json:"username,omitempty"`
+}
+
+// InputPeer 构造 InputPeer
+func (rp *ResolvedPeer) InputPeer() tg.InputPeerClass {
+	switch rp.Kind {
+	case peerKindChannel:
+		return &tg.InputPeerChannel{ChannelID: rp.ID, AccessHash: rp.AccessHash}
+	case peerKindChat:
+		return &tg.InputPeerChat{ChatID: rp.ID}
+	case peerKindUser:
+		return &tg.InputPeerUser{UserID: rp.ID, AccessHash: rp.AccessHash}
+	}
+	return &tg.InputPeerEmpty{}
+}
+
+// InputChannel 构造 InputChannel（仅频道有效）
+func (rp *ResolvedPeer) InputChannel() *tg.InputChannel {
+	return &tg.InputChannel{ChannelID: rp.ID, AccessHash: rp.AccessHash}
+}
+
+// InputUser 构造 InputUser（仅用户有效）
+func (rp *ResolvedPeer) InputUser() *tg.InputUser {
+	return &tg.InputUser{UserID: rp.ID, AccessHash: rp.AccessHash}
+}
+
+// PeerResolver 对等体解析器
+// 依次使用：本地缓存 → 更新事件携带的实体 → channels.getChannels / users.getUsers →
+// 完整翻页的对话列表 → contacts.resolveUsername，解析结果持久化到磁盘
+type PeerResolver struct {
+	api *tg.Client
+
+	mu        sync.RWMutex
+	peers     map[string]*ResolvedPeer // 键格式: "kind:id"
+	usernames map[string]string        // 小写用户名 -> 缓存键
+	dirty     bool
+
+	scanMu       sync.Mutex // 串行化对话扫描
+	lastScanTime time.Time
+}
+
+// NewPeerResolver 创建对等体解析器
+func NewPeerResolver(api *tg.Client) *PeerResolver {
+	return &PeerResolver{
+		api:       api,
+		peers:     make(map[string]*ResolvedPeer),
+		usernames: make(map[string]string),
+	}
+}
+
+// peerKey 生成缓存键
+func peerKey(kind string, id int64) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// store 写入缓存（调用方需持有写锁）
+func (r *PeerResolver) store(peer *ResolvedPeer) {
+	key := peerKey(peer.Kind, peer.ID)
+	if old, exists := r.peers[key]; exists && *old == *peer {
+		return
+	}
+	r.peers[key] = peer
+	if peer.Username != "" {
+		r.usernames[strings.ToLower(peer.Username)] = key
+	}
+	r.dirty = true
+}
+
+// get 读取缓存
+func (r *PeerResolver) get(kind string, id int64) (*ResolvedPeer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	peer, ok := r.peers[peerKey(kind, id)]
+	return peer, ok
+}
+
+// CollectChats 从 Chat 列表中收集频道和群组
+func (r *PeerResolver) CollectChats(chats []tg.ChatClass) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, chat := range chats {
+		switch c := chat.(type) {
+		case *tg.Channel:
+			r.storeChannel(c)
+		case *tg.Chat:
+			r.store(&ResolvedPeer{Kind: peerKindChat, ID: c.ID, Title: c.Title})
+		}
+	}
+}
+
+// CollectUsers 从 User 列表中收集用户
+func (r *PeerResolver) CollectUsers(users []tg.UserClass) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range users {
+		if u, ok := user.(*tg.User); ok {
+			r.storeUser(u)
+		}
+	}
+}
+
+// CollectEntities 从更新事件携带的实体中收集
+func (r *PeerResolver) CollectEntities(e tg.Entities) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range e.Channels {
+		r.storeChannel(c)
+	}
+	for _, c := range e.Chats {
+		r.store(&ResolvedPeer{Kind: peerKindChat, ID: c.ID, Title: c.Title})
+	}
+	for _, u := range e.Users {
+		r.storeUser(u)
+	}
+}
+
+// storeChannel 缓存频道（min 实体的 AccessHash 不可用，跳过）
+func (r *PeerResolver) storeChannel(c *tg.Channel) {
+	if c.Min {
+		return
+	}
+	r.store(&ResolvedPeer{
+		Kind:       peerKindChannel,
+		ID:         c.ID,
+		AccessHash: c.AccessHash,
+		Title:      c.Title,
+		Username:   c.Username,
+	})
+}
+
+// storeUser 缓存用户（min 实体的 AccessHash 不可用，跳过）
+func (r *PeerResolver) storeUser(u *tg.User) {
+	if u.Min {
+		return
+	}
+	title := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	r.store(&ResolvedPeer{
+		Kind:       peerKindUser,
+		ID:         u.ID,
+		AccessHash: u.AccessHash,
+		Title:      title,
+		Username:   u.Username,
+	})
+}
+
+// Channel 解析频道
+func (r *PeerResolver) Channel(ctx context.Context, channelID int64) (*ResolvedPeer, error) {
+	if peer, ok := r.get(peerKindChannel, channelID); ok {
+		return peer, nil
+	}
+
+	// 尝试直接通过 channels.getChannels 获取（公开频道等场景下无需 AccessHash）
+	if chats, err := r.api.ChannelsGetChannels(ctx, []tg.InputChannelClass{
+		&tg.InputChannel{ChannelID: channelID},
+	}); err == nil {
+		r.CollectChats(chats.GetChats())
+		if peer, ok := r.get(peerKindChannel, channelID); ok {
+			return peer, nil
+		}
+	}
+
+	// 翻页扫描全部对话
+	if err := r.scanDialogs(ctx); err != nil {
+		return nil, err
+	}
+	if peer, ok := r.get(peerKindChannel, channelID); ok {
+		return peer, nil
+	}
+
+	return nil, fmt.Errorf("未找到频道 %d，请确认已加入该频道", channelID)
+}
+
+// User 解析用户或机器人
+func (r *PeerResolver) User(ctx context.Context, userID int64) (*ResolvedPeer, error) {
+	if peer, ok := r.get(peerKindUser, userID); ok {
+		return peer, nil
+	}
+
+	if users, err := r.api.UsersGetUsers(ctx, []tg.InputUserClass{
+		&tg.InputUser{UserID: userID},
+	}); err == nil {
+		r.CollectUsers(users)
+		if peer, ok := r.get(peerKindUser, userID); ok {
+			return peer, nil
+		}
+	}
+
+	if err := r.scanDialogs(ctx); err != nil {
+		return nil, err
+	}
+	if peer, ok := r.get(peerKindUser, userID); ok {
+		return peer, nil
+	}
+
+	return nil, fmt.Errorf("未找到用户 %d，请确保已与该用户建立过对话", userID)
+}
+
+// Chat 解析普通群组
+func (r *PeerResolver) Chat(ctx context.Context, chatID int64) (*ResolvedPeer, error) {
+	if peer, ok := r.get(peerKindChat, chatID); ok {
+		return peer, nil
+	}
+
+	chats, err := r.api.MessagesGetChats(ctx, []int64{chatID})
+	if err != nil {
+		return nil, fmt.Errorf("获取群组信息失败: %w", err)
+	}
+	r.CollectChats(chats.GetChats())
+	if peer, ok := r.get(peerKindChat, chatID); ok {
+		return peer, nil
+	}
+
+	return nil, fmt.Errorf("未找到群组 %d", chatID)
+}
+
+// Username 通过用户名解析（缓存未命中时调用 contacts.resolveUsername）
+func (r *PeerResolver) Username(ctx context.Context, username string) (*ResolvedPeer, error) {
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if username == "" {
+		return nil, fmt.Errorf("用户名为空")
+	}
+
+	r.mu.RLock()
+	key, ok := r.usernames[strings.ToLower(username)]
+	var peer *ResolvedPeer
+	if ok {
+		peer = r.peers[key]
+	}
+	r.mu.RUnlock()
+	if peer != nil {
+		return peer, nil
+	}
+
+	resolved, err := r.api.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{Username: username})
+	if err != nil {
+		return nil, fmt.Errorf("解析用户名 @%s 失败: %w", username, err)
+	}
+	r.CollectChats(resolved.Chats)
+	r.CollectUsers(resolved.Users)
+
+	switch p := resolved.Peer.(type) {
+	case *tg.PeerChannel:
+		if peer, ok := r.get(peerKindChannel, p.ChannelID); ok {
+			return peer, nil
+		}
+	case *tg.PeerUser:
+		if peer, ok := r.get(peerKindUser, p.UserID); ok {
+			return peer, nil
+		}
+	case *tg.PeerChat:
+		if peer, ok := r.get(peerKindChat, p.ChatID); ok {
+			return peer, nil
+		}
+	}
+
+	return nil, fmt.Errorf("用户名 @%s 解析结果无效", username)
+}
+
+// inputPeerFromPeer 根据缓存将 Peer 转换为 InputPeer（用于对话翻页偏移）
+func (r *PeerResolver) inputPeerFromPeer(peer tg.PeerClass) tg.InputPeerClass {
+	var kind string
+	var id int64
+	switch p := peer.(type) {
+	case *tg.PeerChannel:
+		kind, id = peerKindChannel, p.ChannelID
+	case *tg.PeerChat:
+		kind, id = peerKindChat, p.ChatID
+	case *tg.PeerUser:
+		kind, id = peerKindUser, p.UserID
+	default:
+		return &tg.InputPeerEmpty{}
+	}
+	if resolved, ok := r.get(kind, id); ok {
+		return resolved.InputPeer()
+	}
+	return &tg.InputPeerEmpty{}
+}
+
+// scanDialogs 翻页扫描全部对话并缓存其中的频道、群组和用户
+// 距离上次扫描不足 dialogsScanMinWait 时直接返回，避免频繁请求
+func (r *PeerResolver) scanDialogs(ctx context.Context) error {
+	r.scanMu.Lock()
+	defer r.scanMu.Unlock()
+
+	if !r.lastScanTime.IsZero() && time.Since(r.lastScanTime) < dialogsScanMinWait {
+		return nil
+	}
+
+	offsetDate := 0
+	offsetID := 0
+	var offsetPeer tg.InputPeerClass = &tg.InputPeerEmpty{}
+
+	for page := 0; page < dialogsMaxPages; page++ {
+		result, err := r.api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
+			OffsetDate: offsetDate,
+			OffsetID:   offsetID,
+			OffsetPeer: offsetPeer,
+			Limit:      dialogsPageSize,
+		})
+		if err != nil {
+			return fmt.Errorf("获取对话列表失败: %w", err)
+		}
+
+		var dialogs []tg.DialogClass
+		var messages []tg.MessageClass
+		hasMore := false
+		switch d := result.(type) {
+		case *tg.MessagesDialogs:
+			r.CollectChats(d.Chats)
+			r.CollectUsers(d.Users)
+			dialogs, messages = d.Dialogs, d.Messages
+		case *tg.MessagesDialogsSlice:
+			r.CollectChats(d.Chats)
+			r.CollectUsers(d.Users)
+			dialogs, messages = d.Dialogs, d.Messages
+			hasMore = len(d.Dialogs) >= dialogsPageSize
+		}
+
+		if !hasMore || len(dialogs) == 0 {
+			break
+		}
+
+		// 以本页最后一个对话的顶部消息作为下一页的偏移
+		last := dialogs[len(dialogs)-1]
+		nextID := last.GetTopMessage()
+		nextDate := 0
+		for _, m := range messages {
+			if msg, ok := m.(*tg.Message); ok && msg.ID == nextID && getPeerID(msg.PeerID) == getPeerID(last.GetPeer()) {
+				nextDate = msg.Date
+				break
+			}
+			if msg, ok := m.(*tg.MessageService); ok && msg.ID == nextID && getPeerID(msg.PeerID) == getPeerID(last.GetPeer()) {
+				nextDate = msg.Date
+				break
+			}
+		}
+		if nextID == offsetID && nextDate == offsetDate {
+			break
+		}
+		offsetID, offsetDate = nextID, nextDate
+		offsetPeer = r.inputPeerFromPeer(last.GetPeer())
+
+		// 短暂延迟避免请求过快
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	r.lastScanTime = time.Now()
+	// fmt.Printf("[DEBUG] 对话扫描完成 (peers=%d)\n", len(r.peers))
+	return nil
+}
+
+// Load 从磁盘加载缓存
+func (r *PeerResolver) Load(filename string) (int, error) {
+	var peers []*ResolvedPeer
+	found, err := loadJSONFile(filename, &peers)
+	if err != nil || !found {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, peer := range peers {
+		r.store(peer)
+	}
+	r.dirty = false
+	return len(peers), nil
+}
+
+// Save 将缓存写入磁盘，无变更时跳过
+func (r *PeerResolver) Save(filename string) error {
+	r.mu.Lock()
+	if !r.dirty {
+		r.mu.Unlock()
+		return nil
+	}
+	peers := make([]*ResolvedPeer, 0, len(r.peers))
+	for _, peer := range r.peers {
+		peers = append(peers, peer)
+	}
+	r.dirty = false
+	r.mu.Unlock()
+
+	if err := saveJSONFile(filename, peers); err != nil {
+		r.mu.Lock()
+		r.dirty = true
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// StartAutoSave 定期将缓存写入磁盘，ctx 结束时执行最后一次保存
+func (r *PeerResolver) StartAutoSave(ctx context.Context, filename string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := r.Save(filename); err != nil {
+				fmt.Printf("⚠️  保存对等体缓存失败: %v\n", err)
+			}
+			return
+		case <-ticker.C:
+			if err := r.Save(filename); err != nil {
+				fmt.Printf("⚠️  保存对等体缓存失败: %v\n", err)
+			}
+		}
+	}
+}
+
+const (
+	peerRefID       = "id"       // 数字ID
+	peerRefUsername = "username" // @username 或 t.me/name
+	peerRefInvite   = "invite"   // t.me/+hash 或 t.me/joinchat/hash
+	peerRefInvalid  = "invalid"
+)
+
+// PeerRef 配置中的对等体引用
+type PeerRef struct {
+	Raw   string
+	Kind  string // id / username / invite / invalid
+	ID    int64  // Kind 为 id 时有效
+	Hint  string // 数字ID可确定的对等体类型（Bot API 格式的负数ID），为空表示未知
+	Value string // Kind 为 username 时为用户名，为 invite 时为邀请哈希
+}
+
+// parsePeerRef 解析配置中的对等体引用
+// 支持格式: 123456789、-100123456789、@name、name、https://t.me/name、t.me/s/name、
+// t.me/c/123456789、t.me/+hash、t.me/joinchat/hash
+func parsePeerRef(raw string) PeerRef {
+	ref := PeerRef{Raw: raw, Kind: peerRefInvalid}
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return ref
+	}
+
+	// 数字ID（兼容 Bot API 的格式：-100 前缀为频道，其余负数为普通群组）
+	if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if strings.HasPrefix(value, "-100") {
+			id, _ = strconv.ParseInt(strings.TrimPrefix(value, "-100"), 10, 64)
+			ref.Hint = peerKindChannel
+		} else if id < 0 {
+			id = -id
+			ref.Hint = peerKindChat
+		}
+		ref.Kind, ref.ID = peerRefID, id
+		return ref
+	}
+
+	if strings.HasPrefix(value, "@") {
+		ref.Kind, ref.Value = peerRefUsername, strings.TrimPrefix(value, "@")
+		return ref
+	}
+
+	// t.me 链接
+	lower := strings.ToLower(value)
+	for _, prefix := range []string{"https://", "http://"} {
+		if strings.HasPrefix(lower, prefix) {
+			value, lower = value[len(prefix):], lower[len(prefix):]
+			break
+		}
+	}
+	for _, host := range []string{"t.me/", "telegram.me/", "telegram.dog/"} {
+		if strings.HasPrefix(lower, host) {
+			path := strings.Trim(strings.SplitN(value[len(host):], "?", 2)[0], "/")
+			parts := strings.Split(path, "/")
+			switch {
+			case strings.HasPrefix(parts[0], "+"):
+				ref.Kind, ref.Value = peerRefInvite, strings.TrimPrefix(parts[0], "+")
+			case parts[0] == "joinchat" && len(parts) > 1:
+				ref.Kind, ref.Value = peerRefInvite, parts[1]
+			case parts[0] == "c" && len(parts) > 1:
+				if id, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+					ref.Kind, ref.ID, ref.Hint = peerRefID, id, peerKindChannel
+				}
+			case parts[0] == "s" && len(parts) > 1:
+				ref.Kind, ref.Value = peerRefUsername, parts[1]
+			case parts[0] != "":
+				ref.Kind, ref.Value = peerRefUsername, parts[0]
+			}
+			return ref
+		}
+	}
+
+	// 不带 @ 的用户名
+	if !strings.ContainsAny(value, " /:") {
+		ref.Kind, ref.Value = peerRefUsername, value
+	}
+	return ref
+}
+
+// Same 两个引用是否明确指向同一对等体（用户名不区分大小写；用户名与数字ID无法离线比较）
+func (r PeerRef) Same(other PeerRef) bool {
+	if r.Kind != other.Kind {
+		return false
+	}
+	switch r.Kind {
+	case peerRefID:
+		return r.ID == other.ID
+	case peerRefUsername:
+		return strings.EqualFold(r.Value, other.Value)
+	case peerRefInvite:
+		return r.Value == other.Value
+	}
+	return false
+}
+
+// Invite 通过邀请链接哈希解析（需要已加入该频道/群组）
+func (r *PeerResolver) Invite(ctx context.Context, hash string) (*ResolvedPeer, error) {
+	invite, err := r.api.MessagesCheckChatInvite(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("检查邀请链接失败: %w", err)
+	}
+
+	var chat tg.ChatClass
+	switch inv := invite.(type) {
+	case *tg.ChatInviteAlready:
+		chat = inv.Chat
+	case *tg.ChatInvitePeek:
+		chat = inv.Chat
+	case *tg.ChatInvite:
+		return nil, fmt.Errorf("尚未加入邀请链接对应的频道/群组「%s」", inv.Title)
+	}
+
+	r.CollectChats([]tg.ChatClass{chat})
+	switch c := chat.(type) {
+	case *tg.Channel:
+		if peer, ok := r.get(peerKindChannel, c.ID); ok {
+			return peer, nil
+		}
+	case *tg.Chat:
+		if peer, ok := r.get(peerKindChat, c.ID); ok {
+			return peer, nil
+		}
+	}
+	return nil, fmt.Errorf("邀请链接解析结果无效")
+}
+
+// ResolveRef 解析配置中的对等体引用，kind 指定数字ID按哪种类型解析
+// kind 为空时按ID格式推断，无法推断时依次尝试频道、用户、普通群组
+func (r *PeerResolver) ResolveRef(ctx context.Context, raw string, kind string) (*ResolvedPeer, error) {
+	ref := parsePeerRef(raw)
+	switch ref.Kind {
+	case peerRefID:
+		if kind == "" {
+			kind = ref.Hint
+		}
+		if kind == "" {
+			peer, err := r.Channel(ctx, ref.ID)
+			if err == nil {
+				return peer, nil
+			}
+			if peer, userErr := r.User(ctx, ref.ID); userErr == nil {
+				return peer, nil
+			}
+			if peer, chatErr := r.Chat(ctx, ref.ID); chatErr == nil {
+				return peer, nil
+			}
+			return nil, err
+		}
+		switch kind {
+		case peerKindUser:
+			return r.User(ctx, ref.ID)
+		case peerKindChat:
+			return r.Chat(ctx, ref.ID)
+		default:
+			return r.Channel(ctx, ref.ID)
+		}
+	case peerRefUsername:
+		return r.Username(ctx, ref.Value)
+	case peerRefInvite:
+		return r.Invite(ctx, ref.Value)
+	}
+	return nil, fmt.Errorf("无法识别的格式（支持数字ID、@username、https://t.me/name、t.me/+invite）")
+}
+
+// resolveConfiguredPeers 启动时解析配置中的频道和签到机器人，逐条输出解析结果
+// 单条解析失败只跳过该条目；数字ID即使解析失败也保留（兼容旧配置）
+func (p *MessageProcessor) resolveConfiguredPeers(ctx context.Context) {
+	// 监听列表可包含频道、普通群组和用户（私聊 / 机器人），记录每个ID的类型
+	kinds := make(map[int64]string)
+	resolveChannel := func(label string, raw string) (int64, bool) {
+		ref := parsePeerRef(raw)
+		peer, err := p.peers.ResolveRef(ctx, raw, "")
+		if err != nil {
+			if ref.Kind == peerRefID {
+				fmt.Printf("⚠️  %s %q 获取信息失败，仍按ID %d 监听: %v\n", label, raw, ref.ID, err)
+				if ref.Hint != "" {
+					kinds[ref.ID] = ref.Hint
+				}
+				return ref.ID, true
+			}
+			fmt.Printf("❌ %s %q 解析失败，已跳过: %v\n", label, raw, err)
+			return 0, false
+		}
+		fmt.Printf("✅ %s: %s (ID: %d, 类型: %s, 配置: %s)\n", label, peer.Title, peer.ID, peer.Kind, raw)
+		kinds[peer.ID] = peer.Kind
+		return peer.ID, true
+	}
+
+	if p.config.Monitor.Enabled {
+		var channels []int64
+		overrides := make(map[int64]*ChannelEntry)
+		for i := range p.config.Monitor.ChannelRefs {
+			entry := &p.config.Monitor.ChannelRefs[i]
+			id, ok := resolveChannel("监听频道", entry.Ref)
+			if !ok {
+				continue
+			}
+			channels = append(channels, id)
+			if entry.HasOverrides() {
+				overrides[id] = entry
+			}
+		}
+		p.config.Monitor.Channels = channels
+		p.config.Monitor.ChannelOverrides = overrides
+		p.config.Monitor.PeerKinds = kinds
+
+		var whitelist []int64
+		for _, raw := range p.config.Monitor.WhitelistRefs {
+			if id, ok := resolveChannel("白名单频道", raw); ok {
+				whitelist = append(whitelist, id)
+			}
+		}
+		p.config.Monitor.WhitelistChannels = whitelist
+
+		for id := range overrides {
+			fmt.Printf("📋 频道 %d 使用独立规则 (%s)\n", id, p.channelRules(id).Summary())
+		}
+
+		if len(p.config.Monitor.Channels) == 0 {
+			fmt.Println("⚠️  没有可用的监听频道，自动禁用 Monitor 功能")
+			p.config.Monitor.Enabled = false
+		}
+	}
+
+	if p.config.CheckIn.Enabled {
+		for i := range p.config.CheckIn.Tasks {
+			task := &p.config.CheckIn.Tasks[i]
+			peer, err := p.peers.ResolveRef(ctx, task.BotRef, peerKindUser)
+			if err != nil {
+				if ref := parsePeerRef(task.BotRef); ref.Kind == peerRefID {
+					fmt.Printf("⚠️  签到机器人 %q 获取信息失败，仍按ID %d 签到: %v\n", task.BotRef, ref.ID, err)
+				} else {
+					fmt.Printf("❌ 签到机器人 %q 解析失败，该任务已禁用: %v\n", task.BotRef, err)
+				}
+				continue
+			}
+			task.Bot = peer.ID
+			fmt.Printf("✅ 签到机器人: %s (ID: %d, 配置: %s)\n", peer.Title, peer.ID, task.BotRef)
+		}
+	}
+}
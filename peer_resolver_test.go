@@ -0,0 +1,55 @@
+// tdl-msgproce - 对等体引用解析测试
+package main
+
+import "testing"
+
+func TestParsePeerRef(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want PeerRef
+	}{
+		{"123456789", PeerRef{Kind: peerRefID, ID: 123456789}},
+		{"-1001234567890", PeerRef{Kind: peerRefID, ID: 1234567890, Hint: peerKindChannel}},
+		{"-987654", PeerRef{Kind: peerRefID, ID: 987654, Hint: peerKindChat}},
+		{" -1001234567890 ", PeerRef{Kind: peerRefID, ID: 1234567890, Hint: peerKindChannel}},
+		{"@Example_Channel", PeerRef{Kind: peerRefUsername, Value: "Example_Channel"}},
+		{"example_channel", PeerRef{Kind: peerRefUsername, Value: "example_channel"}},
+		{"https://t.me/example", PeerRef{Kind: peerRefUsername, Value: "example"}},
+		{"HTTPS://T.ME/Example/", PeerRef{Kind: peerRefUsername, Value: "Example"}},
+		{"t.me/s/example?before=10", PeerRef{Kind: peerRefUsername, Value: "example"}},
+		{"https://telegram.me/example/123", PeerRef{Kind: peerRefUsername, Value: "example"}},
+		{"https://t.me/c/1234567890/42", PeerRef{Kind: peerRefID, ID: 1234567890, Hint: peerKindChannel}},
+		{"https://t.me/+AbCdEf123", PeerRef{Kind: peerRefInvite, Value: "AbCdEf123"}},
+		{"t.me/joinchat/AbCdEf123", PeerRef{Kind: peerRefInvite, Value: "AbCdEf123"}},
+		{"", PeerRef{Kind: peerRefInvalid}},
+		{"https://example.com/channel", PeerRef{Kind: peerRefInvalid}},
+		{"https://t.me/c/notanumber", PeerRef{Kind: peerRefInvalid}},
+		{"two words", PeerRef{Kind: peerRefInvalid}},
+	}
+	for _, tt := range tests {
+		tt.want.Raw = tt.raw
+		if got := parsePeerRef(tt.raw); got != tt.want {
+			t.Errorf("parsePeerRef(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestPeerRefSame(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"-1001234567890", "https://t.me/c/1234567890", true},
+		{"@Example", "https://t.me/example", true},
+		{"t.me/+AbC", "t.me/joinchat/AbC", true},
+		{"t.me/+AbC", "t.me/+abc", false}, // 邀请哈希区分大小写
+		{"@example", "-1001234567890", false},
+		{"123", "456", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := parsePeerRef(tt.a).Same(parsePeerRef(tt.b)); got != tt.want {
+			t.Errorf("Same(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// tdl-msgproce - 异步消息处理流水线（有界队列 + 工作协程池）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	defaultPipelineWorkers   = 4                // 默认工作协程数
+	defaultPipelineQueueSize = 1000             // 默认队列容量（所有工作协程合计）
+	pipelineDrainTimeout     = 60 * time.Second // 退出时等待队列排空的最长时间
+)
+
+// queuedMessage 排队等待处理的消息
+type queuedMessage struct {
+	msg      *tg.Message
+	entities tg.Entities
+	edited   bool
+	done     func(subs int, nodes int) // 处理完成后的回调（可选，用于历史消息统计）
+}
+
+// MessagePipeline 有界消息队列，按会话ID分片到固定的工作协程，保证同一频道内按顺序处理
+// 队列满时 Enqueue 阻塞（反压），避免更新分发被单个繁忙频道拖住的同时不丢消息
+type MessagePipeline struct {
+	shards []chan queuedMessage
+	handle func(ctx context.Context, job queuedMessage)
+
+	ctx    context.Context // 工作协程使用的 context，排空超时后取消
+	cancel context.CancelFunc
+
+	mu      sync.RWMutex
+	closed  bool
+	wg      sync.WaitGroup
+	drained chan struct{} // 排空完成后关闭
+}
+
+// NewMessagePipeline 创建并启动消息处理流水线
+func NewMessagePipeline(workers int, queueSize int, handle func(ctx context.Context, job queuedMessage)) *MessagePipeline {
+	if workers <= 0 {
+		workers = defaultPipelineWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultPipelineQueueSize
+	}
+	shardSize := queueSize / workers
+	if shardSize < 1 {
+		shardSize = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &MessagePipeline{
+		shards:  make([]chan queuedMessage, workers),
+		handle:  handle,
+		ctx:     ctx,
+		cancel:  cancel,
+		drained: make(chan struct{}),
+	}
+	for i := range q.shards {
+		q.shards[i] = make(chan queuedMessage, shardSize)
+		q.wg.Add(1)
+		go q.worker(q.shards[i])
+	}
+	return q
+}
+
+// worker 依次处理分片中的消息，分片关闭且排空后退出
+func (q *MessagePipeline) worker(shard chan queuedMessage) {
+	defer q.wg.Done()
+	for job := range shard {
+		q.handle(q.ctx, job)
+	}
+}
+
+// Enqueue 将消息加入所属会话的分片，队列满时阻塞直到有空位或 ctx 结束
+func (q *MessagePipeline) Enqueue(ctx context.Context, job queuedMessage) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return fmt.Errorf("处理队列已关闭")
+	}
+
+	peerID := getPeerID(job.msg.PeerID)
+	shard := q.shards[uint64(peerID)%uint64(len(q.shards))]
+
+	select {
+	case shard <- job:
+		return nil
+	default:
+	}
+
+	fmt.Printf("⏳ 处理队列已满，等待空位... (频道=%d, 消息ID=%d)\n", peerID, job.msg.ID)
+	select {
+	case shard <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Len 返回队列中等待处理的消息数和总容量
+func (q *MessagePipeline) Len() (int, int) {
+	pending, capacity := 0, 0
+	for _, shard := range q.shards {
+		pending += len(shard)
+		capacity += cap(shard)
+	}
+	return pending, capacity
+}
+
+// Close 停止接收新消息并等待已排队的消息处理完毕，超时后取消剩余处理
+// 重复调用时等待首次调用排空完成
+func (q *MessagePipeline) Close(timeout time.Duration) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		<-q.drained
+		return
+	}
+	defer close(q.drained)
+	q.closed = true
+	for _, shard := range q.shards {
+		close(shard)
+	}
+	q.mu.Unlock()
+
+	pending, _ := q.Len()
+	if pending > 0 {
+		fmt.Printf("⏳ 等待处理队列排空 (剩余 %d 条)...\n", pending)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		pending, _ := q.Len()
+		fmt.Printf("⚠️  处理队列排空超时，放弃剩余 %d 条消息\n", pending)
+		q.cancel()
+		<-done
+	}
+	q.cancel()
+}
+
+// drainPipeline 排空处理队列，再提交剩余的节点批次（退出时在客户端停止前调用）
+func (p *MessageProcessor) drainPipeline() {
+	p.pipeline.Close(pipelineDrainTimeout)
+	if p.batcher != nil {
+		p.batcher.Close(batcherDrainTimeout)
+	}
+}
+
+// enqueueMessage 将更新中的消息加入处理队列
+func (p *MessageProcessor) enqueueMessage(ctx context.Context, msg *tg.Message, entities tg.Entities, edited bool) {
+	if err := p.pipeline.Enqueue(ctx, queuedMessage{msg: msg, entities: entities, edited: edited}); err != nil {
+		fmt.Printf("⚠️  消息未能加入处理队列 (ID=%d): %v\n", msg.ID, err)
+	}
+}
+
+// processQueuedMessage 工作协程中处理单条排队消息
+func (p *MessageProcessor) processQueuedMessage(ctx context.Context, job queuedMessage) {
+	var subs, nodes int
+	var err error
+	if job.edited {
+		if subs, nodes, err = p.handleEditMessage(ctx, job.msg, job.entities); err != nil {
+			fmt.Printf("处理编辑消息失败: %v\n", err)
+		}
+	} else if subs, nodes, err = p.handleMessage(ctx, job.msg, job.entities); err != nil {
+		fmt.Printf("处理新消息失败: %v\n", err)
+	}
+	if job.done != nil {
+		job.done(subs, nodes)
+	}
+}
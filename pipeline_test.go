@@ -0,0 +1,139 @@
+// tdl-msgproce - 消息处理流水线测试
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+func newQueuedChannelMessage(channelID int64, id int) queuedMessage {
+	return queuedMessage{msg: &tg.Message{ID: id, PeerID: &tg.PeerChannel{ChannelID: channelID}}}
+}
+
+func TestMessagePipelineOrderPerChannel(t *testing.T) {
+	var mu sync.Mutex
+	got := make(map[int64][]int)
+	q := NewMessagePipeline(3, 30, func(ctx context.Context, job queuedMessage) {
+		// 不同消息耗时不同，同一频道仍需按入队顺序处理
+		time.Sleep(time.Duration(job.msg.ID%3) * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		channelID := getPeerID(job.msg.PeerID)
+		got[channelID] = append(got[channelID], job.msg.ID)
+	})
+
+	want := make(map[int64][]int)
+	for id := 1; id <= 20; id++ {
+		for _, channelID := range []int64{1001, 1002, 1003, 1004} {
+			if err := q.Enqueue(context.Background(), newQueuedChannelMessage(channelID, id)); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+			peerID := getPeerID(&tg.PeerChannel{ChannelID: channelID})
+			want[peerID] = append(want[peerID], id)
+		}
+	}
+	q.Close(5 * time.Second)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("处理顺序 = %v, want %v", got, want)
+	}
+}
+
+func TestMessagePipelineBackpressure(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	q := NewMessagePipeline(1, 1, func(ctx context.Context, job queuedMessage) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	defer q.Close(time.Second)
+
+	// 第一条被工作协程取走并阻塞，第二条占满队列
+	if err := q.Enqueue(context.Background(), newQueuedChannelMessage(1001, 1)); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	<-started
+	if err := q.Enqueue(context.Background(), newQueuedChannelMessage(1001, 2)); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if pending, capacity := q.Len(); pending != 1 || capacity != 1 {
+		t.Fatalf("Len = %d/%d, want 1/1", pending, capacity)
+	}
+
+	// 队列满时阻塞，直到 ctx 结束
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Enqueue(ctx, newQueuedChannelMessage(1001, 3)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("队列满时 Enqueue = %v, want DeadlineExceeded", err)
+	}
+
+	// 有空位后入队成功
+	close(release)
+	if err := q.Enqueue(context.Background(), newQueuedChannelMessage(1001, 3)); err != nil {
+		t.Errorf("Enqueue after release: %v", err)
+	}
+}
+
+func TestMessagePipelineCloseDrains(t *testing.T) {
+	var mu sync.Mutex
+	handled := 0
+	q := NewMessagePipeline(2, 10, func(ctx context.Context, job queuedMessage) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		handled++
+		mu.Unlock()
+	})
+	for id := 1; id <= 10; id++ {
+		if err := q.Enqueue(context.Background(), newQueuedChannelMessage(int64(1000+id%2), id)); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	q.Close(5 * time.Second)
+	if handled != 10 {
+		t.Errorf("排空后处理了 %d 条, want 10", handled)
+	}
+	if err := q.Enqueue(context.Background(), newQueuedChannelMessage(1001, 11)); err == nil {
+		t.Errorf("关闭后 Enqueue 应返回错误")
+	}
+	q.Close(time.Second) // 重复调用直接返回
+}
+
+func TestMessagePipelineCloseTimeout(t *testing.T) {
+	var mu sync.Mutex
+	var cancelled []int
+	q := NewMessagePipeline(1, 5, func(ctx context.Context, job queuedMessage) {
+		if job.msg.ID == 1 {
+			<-ctx.Done() // 模拟卡住的处理，排空超时后被取消
+		}
+		if ctx.Err() != nil {
+			mu.Lock()
+			cancelled = append(cancelled, job.msg.ID)
+			mu.Unlock()
+		}
+	})
+	for id := 1; id <= 3; id++ {
+		if err := q.Enqueue(context.Background(), newQueuedChannelMessage(1001, id)); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	start := time.Now()
+	q.Close(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Close 耗时 %v，超时后应取消剩余处理", elapsed)
+	}
+	// 超时后剩余消息以已取消的 ctx 处理（处理函数据此尽快返回）
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(cancelled, want) {
+		t.Errorf("取消后处理的消息 = %v, want %v", cancelled, want)
+	}
+}
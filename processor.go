@@ -20,20 +20,39 @@ import (
 
 // MessageProcessor 消息处理器
 type MessageProcessor struct {
-	ext            *extension.Extension
-	config         *Config
-	api            *tg.Client
-	client         *telegram.Client
-	selfUserID     int64
-	messageCount   int64
-	editedMsgCount int64 // 编辑消息计数
-	forwardCount   int64
-	lastHeartbeat  time.Time
-	messageCache   *MessageCache
-	channelPts     map[int64]int // 每个频道的 pts 状态
-	channelPtsMu   sync.RWMutex  // pts 状态的互斥锁
-	linkRegex      *regexp.Regexp // 预编译的链接提取正则表达式
-	
+	ext               *extension.Extension
+	config            *Config
+	api               *tg.Client
+	client            *telegram.Client
+	selfUserID        int64
+	messageCount      int64
+	editedMsgCount    int64 // 编辑消息计数
+	forwardCount      int64
+	lastHeartbeat     time.Time
+	messageCache      *MessageCache
+	messageLinks      *MessageLinkStore     // 每条消息上次通过过滤的链接（编辑消息只提交新增链接）
+	peers             *PeerResolver         // 统一的对等体解析器（AccessHash 缓存）
+	nodeDedup         *NodeDedup            // 已提交节点的规范化指纹缓存
+	pipeline          *MessagePipeline      // 异步消息处理队列
+	stats             *ChannelStatsTracker  // 按频道统计处理结果
+	subAPI            *SubscriptionClient   // 订阅 API 客户端
+	outbox            *Outbox               // 提交失败的持久化发件箱
+	sinks             *SinkRegistry         // 已配置的输出目标
+	batcher           *NodeBatcher          // 跨消息节点批量提交（未启用时为 nil）
+	subChecker        *SubscriptionChecker  // 订阅预检（未启用时为 nil）
+	subRegistry       *SubscriptionRegistry // 订阅流量与到期记录
+	subRecheck        time.Duration         // 流量耗尽订阅的复查间隔
+	prober            *NodeProber           // 节点本地探测（未启用时为 nil）
+	dryRun            *DryRunRecorder       // 演练模式的决策记录（未启用时为 nil）
+	channelPts        map[int64]int         // 每个频道的 pts 状态
+	channelPtsMu      sync.RWMutex          // pts 状态的互斥锁
+	channelLastMsgID  map[int64]int         // 每个频道最后处理的消息ID（历史消息高水位）
+	historyResumeIDs  map[int64]int         // 启动时加载的高水位快照（历史消息续取起点，加载后只读）
+	channelStatePath  string                // 频道同步状态文件路径
+	channelStateDirty bool                  // 频道同步状态是否有未保存的变更
+	channelCatchingUp map[int64]bool        // 正在执行差异补偿的频道
+	linkRegex         *regexp.Regexp        // 预编译的链接提取正则表达式
+
 	// 消息集合追踪（用于 auto_reclone_forwards）
 	groupedMessages   map[int64][]int // groupedID -> []messageID
 	groupedMessagesMu sync.RWMutex
@@ -75,20 +94,52 @@ func (p *MessageProcessor) StartHeartbeat(ctx context.Context) {
 func (p *MessageProcessor) RegisterHandlers(dispatcher tg.UpdateDispatcher) {
 	// 1. 处理新的频道消息
 	dispatcher.OnNewChannelMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewChannelMessage) error {
+		p.peers.CollectEntities(e)
 		if msg, ok := update.Message.(*tg.Message); ok {
-			if _, _, err := p.handleMessage(ctx, msg, e); err != nil {
-				fmt.Printf("处理新消息失败: %v\n", err)
+			// 追踪频道 pts，发现缺口时补偿漏掉的消息
+			if channelID := getPeerID(msg.PeerID); p.trackChannelPts(channelID, update.Pts, update.PtsCount) {
+				p.triggerChannelCatchUp(channelID, "pts 缺口")
 			}
+			p.enqueueMessage(ctx, msg, e, false)
 		}
 		return nil
 	})
 
 	// 2. 处理被编辑的频道消息
 	dispatcher.OnEditChannelMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateEditChannelMessage) error {
+		p.peers.CollectEntities(e)
 		if msg, ok := update.Message.(*tg.Message); ok {
-			if _, _, err := p.handleEditMessage(ctx, msg, e); err != nil {
-				fmt.Printf("处理编辑消息失败: %v\n", err)
+			if channelID := getPeerID(msg.PeerID); p.trackChannelPts(channelID, update.Pts, update.PtsCount) {
+				p.triggerChannelCatchUp(channelID, "pts 缺口")
 			}
+			p.enqueueMessage(ctx, msg, e, true)
+		}
+		return nil
+	})
+
+	// 3. 处理普通群组、私聊和机器人对话中的新消息
+	dispatcher.OnNewMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewMessage) error {
+		p.peers.CollectEntities(e)
+		if msg, ok := update.Message.(*tg.Message); ok {
+			p.enqueueMessage(ctx, msg, e, false)
+		}
+		return nil
+	})
+
+	// 4. 处理普通群组、私聊和机器人对话中被编辑的消息
+	dispatcher.OnEditMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateEditMessage) error {
+		p.peers.CollectEntities(e)
+		if msg, ok := update.Message.(*tg.Message); ok {
+			p.enqueueMessage(ctx, msg, e, true)
+		}
+		return nil
+	})
+
+	// 5. 服务器通知频道更新过多（通常发生在断线重连后），需要主动拉取差异
+	dispatcher.OnChannelTooLong(func(ctx context.Context, e tg.Entities, update *tg.UpdateChannelTooLong) error {
+		p.peers.CollectEntities(e)
+		if contains(p.config.Monitor.Channels, update.ChannelID) {
+			p.triggerChannelCatchUp(update.ChannelID, "频道更新过多")
 		}
 		return nil
 	})
@@ -99,14 +150,15 @@ func (p *MessageProcessor) StartMessageListener(ctx context.Context) error {
 	// 异步获取历史消息，避免阻塞启动
 	go func() {
 		fetchCount := p.config.Monitor.Features.FetchHistoryCount
-		if fetchCount > 0 && len(p.config.Monitor.Channels) > 0 {
-			fmt.Printf("📥 历史消息功能: ✅ 已启用 (每个频道获取 %d 条)\n", fetchCount)
-			fmt.Printf("🔄 正在获取 %d 个频道的历史消息...\n", len(p.config.Monitor.Channels))
+		channels := p.monitoredChannels()
+		if fetchCount > 0 && len(channels) > 0 {
+			fmt.Printf("📥 历史消息功能: ✅ 已启用 (首次监听的频道获取 %d 条，其余从上次处理位置续取)\n", fetchCount)
+			fmt.Printf("🔄 正在获取 %d 个频道的历史消息...\n", len(channels))
 			// 使用一个新的后台 context，以防主 context 因为其他原因提前结束
 			bgCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 			defer cancel()
 
-			for _, channelID := range p.config.Monitor.Channels {
+			for _, channelID := range channels {
 				if err := p.fetchChannelHistory(bgCtx, channelID, fetchCount); err != nil {
 					fmt.Printf("获取历史消息失败 (频道=%d): %v\n", channelID, err)
 				}
@@ -115,15 +167,25 @@ func (p *MessageProcessor) StartMessageListener(ctx context.Context) error {
 		} else {
 			fmt.Printf("📥 历史消息功能: ❌ 已禁用\n")
 		}
+
+		// 根据已记录的 pts 补偿停机期间漏掉的消息（已处理的消息由缓存去重）
+		catchUpCtx, catchUpCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		p.catchUpAllChannels(catchUpCtx)
+		catchUpCancel()
 	}()
 
+	// 定期补偿，覆盖连接中断期间漏掉的更新
+	go p.StartChannelCatchUpLoop(ctx)
+
 	// client.Run 是一个阻塞操作。
 	// tdl 框架已经为我们创建并配置好了这个 client，我们只需要调用 Run() 即可。
 	// 它会自动处理连接、认证和接收更新的循环。
-	// 当传入的 ctx 被取消时（例如用户按 Ctrl+C），Run 方法会自动返回。
-	return p.client.Run(ctx, func(ctx context.Context) error {
+	// 客户端使用不随 ctx 取消的 context：收到停止信号（例如用户按 Ctrl+C）后，
+	// 先排空处理队列和节点批次（Telegram 输出、文档下载仍需使用客户端），再返回并停止客户端。
+	return p.client.Run(context.WithoutCancel(ctx), func(context.Context) error {
 		fmt.Printf("✅ 消息监听器已连接并成功运行\n")
 		<-ctx.Done()
+		p.drainPipeline()
 		return ctx.Err()
 	})
 }
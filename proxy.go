@@ -14,11 +14,16 @@ import (
 	"time"
 )
 
+// subscriptionUserAgent 下载订阅时使用的 UA（订阅服务按 UA 返回 Clash 或通用格式）
+const subscriptionUserAgent = "clash-verge/v2.4.7"
+
 // ProxyServer HTTP 代理服务器（用于订阅解析）
 type ProxyServer struct {
 	cfg       *ProxyConfig
 	server    *http.Server
 	semaphore chan struct{} // 并发限制
+
+	subRegistry *SubscriptionRegistry // 记录订阅的流量与到期信息（可为 nil）
 }
 
 // NewProxyServer 创建新的代理服务器实例
@@ -72,7 +77,7 @@ func (ps *ProxyServer) handleProxy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 不透传客户端请求头，避免上游根据浏览器头返回差异内容
-	proxyReq.Header.Set("User-Agent", "clash-verge/v2.4.7")
+	proxyReq.Header.Set("User-Agent", subscriptionUserAgent)
 
 	// 创建 HTTP 客户端，设置超时
 	client := &http.Client{
@@ -87,7 +92,17 @@ func (ps *ProxyServer) handleProxy(w http.ResponseWriter, r *http.Request) {
 	}
 	defer resp.Body.Close()
 
-	// 固定响应类型，不透传上游响应头
+	// 记录订阅流量与到期信息，并透传给客户端（客户端据此显示剩余流量）
+	if info := parseSubUserInfo(resp.Header); info != nil {
+		if ps.subRegistry != nil && resp.StatusCode < 400 {
+			if reason := ps.subRegistry.Record(targetURL, info, "", 0); reason != "" {
+				fmt.Printf("🪫 代理订阅已失效 (%s, %s): %s\n", reason, info, targetURL)
+			}
+		}
+		w.Header().Set("Subscription-Userinfo", resp.Header.Get("Subscription-Userinfo"))
+	}
+
+	// 固定响应类型，其余上游响应头不透传
 	w.Header().Set("Content-Type", "text/plain")
 
 	// 透传上游响应状态码，仅透传响应内容
@@ -0,0 +1,432 @@
+// tdl-msgproce - 离线回放 tdl chat export 导出的消息（演练过滤与提取规则）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gotd/td/tg"
+	"github.com/iyear/tdl/extension"
+)
+
+// tdlExport tdl chat export 导出的 JSON（兼容 --raw 导出的原始消息字段）
+type tdlExport struct {
+	ID       int64              `json:"id"`
+	Messages []tdlExportMessage `json:"messages"`
+}
+
+// tdlExportMessage 导出的单条消息
+type tdlExportMessage struct {
+	ID       int               `json:"id"`
+	Date     int               `json:"date"`
+	Text     json.RawMessage   `json:"text"`    // 字符串，或 Telegram Desktop 格式的文本片段数组
+	Message  string            `json:"message"` // --raw 导出的消息正文
+	Entities []tdlExportEntity `json:"entities"`
+}
+
+// tdlExportEntity 导出的消息实体（只关心文本超链接）
+type tdlExportEntity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	URL    string `json:"url"`
+	Href   string `json:"href"`
+}
+
+// toMessage 转换为 tg.Message，供监听流水线处理
+func (m tdlExportMessage) toMessage() *tg.Message {
+	text, entities := m.text()
+	for _, e := range m.Entities {
+		if url := firstNonEmpty(e.URL, e.Href); url != "" {
+			entities = append(entities, &tg.MessageEntityTextURL{Offset: e.Offset, Length: e.Length, URL: url})
+		}
+	}
+
+	msg := &tg.Message{ID: m.ID, Date: m.Date, Message: text}
+	if len(entities) > 0 {
+		msg.SetEntities(entities)
+	}
+	return msg
+}
+
+// text 解析消息正文；文本片段数组中的超链接转换为实体（偏移量按 UTF-16 计算）
+func (m tdlExportMessage) text() (string, []tg.MessageEntityClass) {
+	var s string
+	if len(m.Text) == 0 || json.Unmarshal(m.Text, &s) == nil {
+		return firstNonEmpty(s, m.Message), nil
+	}
+
+	var parts []json.RawMessage
+	if json.Unmarshal(m.Text, &parts) != nil {
+		return m.Message, nil
+	}
+	var sb strings.Builder
+	var entities []tg.MessageEntityClass
+	offset := 0
+	for _, raw := range parts {
+		var part struct {
+			Text string `json:"text"`
+			Href string `json:"href"`
+		}
+		if json.Unmarshal(raw, &part.Text) != nil && json.Unmarshal(raw, &part) != nil {
+			continue
+		}
+		length := len(utf16.Encode([]rune(part.Text)))
+		if part.Href != "" {
+			entities = append(entities, &tg.MessageEntityTextURL{Offset: offset, Length: length, URL: part.Href})
+		}
+		sb.WriteString(part.Text)
+		offset += length
+	}
+	return sb.String(), entities
+}
+
+// loadTDLExport 读取导出文件，消息按 ID 升序排列（与实时接收顺序一致）
+func loadTDLExport(path string) (*tdlExport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	var export tdlExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+	sort.SliceStable(export.Messages, func(i, j int) bool {
+		return export.Messages[i].ID < export.Messages[j].ID
+	})
+	return &export, nil
+}
+
+// ReplayReport 回放结果
+type ReplayReport struct {
+	File          string
+	ChannelID     int64
+	Messages      int
+	Submitted     int            // 将会提交链接的消息数
+	Subscriptions int            // 将会提交的订阅数
+	Nodes         int            // 将会提交的节点数
+	SkippedBy     map[string]int // 跳过消息的过滤阶段 -> 次数
+	Protocols     map[string]int // 将会提交的链接协议 -> 次数
+	Sinks         map[string]int // 输出目标 -> 将会提交的链接数
+	Stats         ChannelStats
+	Records       []*DryRunRecord
+	Duration      time.Duration
+}
+
+// Summary 回放报告文本
+func (r *ReplayReport) Summary() string {
+	countText := func(m map[string]int) string {
+		if len(m) == 0 {
+			return "无"
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if m[keys[i]] != m[keys[j]] {
+				return m[keys[i]] > m[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		parts := make([]string, 0, len(keys))
+		for _, k := range keys {
+			parts = append(parts, fmt.Sprintf("%s×%d", k, m[k]))
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🎞️ 回放完成: %s\n", filepath.Base(r.File)))
+	sb.WriteString(fmt.Sprintf("• 频道: %d\n", r.ChannelID))
+	sb.WriteString(fmt.Sprintf("• 消息: %d (将提交 %d, 跳过 %d)\n", r.Messages, r.Submitted, r.Messages-r.Submitted))
+	sb.WriteString(fmt.Sprintf("• 订阅: %d, 节点: %d\n", r.Subscriptions, r.Nodes))
+	sb.WriteString(fmt.Sprintf("• 重复: %d, 修复: %d, 无效: %d\n", r.Stats.Duplicates, r.Stats.Repaired, r.Stats.Invalid))
+	sb.WriteString(fmt.Sprintf("• 跳过原因: %s\n", countText(r.SkippedBy)))
+	sb.WriteString(fmt.Sprintf("• 协议: %s\n", countText(r.Protocols)))
+	sb.WriteString(fmt.Sprintf("• 输出目标: %s\n", countText(r.Sinks)))
+	sb.WriteString(fmt.Sprintf("• 耗时: %v", r.Duration.Round(time.Millisecond)))
+	return sb.String()
+}
+
+// WriteRecords 以 JSON Lines 写入每条消息的决策记录
+func (r *ReplayReport) WriteRecords(path string) error {
+	var sb strings.Builder
+	for _, record := range r.Records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+	return writeFileAtomic(path, []byte(sb.String()))
+}
+
+// newReplayProcessor 创建离线回放用的处理器：共享配置和输出目标，统计和去重状态独立，
+// 不下载订阅、不探测节点、不提交，所有决策写入内存
+func (p *MessageProcessor) newReplayProcessor() *MessageProcessor {
+	return &MessageProcessor{
+		config:    p.config,
+		peers:     p.peers,
+		sinks:     p.sinks,
+		linkRegex: p.linkRegex,
+		stats:     NewChannelStatsTracker(),
+		nodeDedup: NewNodeDedup(nodeFingerprintTTL),
+		dryRun:    newMemoryDryRunRecorder(),
+
+		messageLinks: NewMessageLinkStore(messageLinksCapacity),
+	}
+}
+
+// replayExport 将导出文件中的消息依次送入监听流水线（演练模式），返回回放报告
+// channelID 为 0 时使用导出文件中的频道ID（决定生效的频道规则）
+func (p *MessageProcessor) replayExport(ctx context.Context, path string, channelID int64) (*ReplayReport, error) {
+	export, err := loadTDLExport(path)
+	if err != nil {
+		return nil, err
+	}
+	if channelID == 0 {
+		channelID = parsePeerRef(strconv.FormatInt(export.ID, 10)).ID
+	}
+
+	start := time.Now()
+	rp := p.newReplayProcessor()
+	for _, m := range export.Messages {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if _, _, err := rp.processMessageContent(ctx, m.toMessage(), channelID, false); err != nil {
+			fmt.Printf("⚠️  回放消息失败 (ID=%d): %v\n", m.ID, err)
+		}
+	}
+
+	report := &ReplayReport{
+		File:      path,
+		ChannelID: channelID,
+		Messages:  len(export.Messages),
+		SkippedBy: make(map[string]int),
+		Protocols: make(map[string]int),
+		Sinks:     make(map[string]int),
+		Stats:     rp.stats.Snapshot()[channelID],
+		Records:   rp.dryRun.Records(),
+		Duration:  time.Since(start),
+	}
+	for _, record := range report.Records {
+		if record.Decision != "submit" {
+			report.SkippedBy[record.SkippedBy]++
+			continue
+		}
+		report.Submitted++
+		for _, link := range record.Links {
+			if len(link.Sinks) == 0 {
+				continue
+			}
+			if link.Kind == "node" {
+				report.Nodes++
+			} else {
+				report.Subscriptions++
+			}
+			if idx := strings.Index(link.Link, "://"); idx > 0 {
+				report.Protocols[strings.ToLower(link.Link[:idx])]++
+			}
+			for _, name := range link.Sinks {
+				report.Sinks[name]++
+			}
+		}
+	}
+	return report, nil
+}
+
+// handleReplayDocument 处理带 /replay 说明的导出文件：离线回放并回复报告
+// 说明中可附带频道ID（/replay 123456789），用于选择频道级规则
+func (p *MessageProcessor) handleReplayDocument(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+	doc := msg.Document
+	var channelID int64
+	if fields := strings.Fields(msg.Caption); len(fields) > 1 {
+		ref := parsePeerRef(fields[1])
+		if ref.Kind != peerRefID {
+			p.sendBotReply(bot, msg.Chat.ID, msg.MessageID, "❌ 频道ID格式错误\n\n用法：发送导出的 JSON 文件，说明填写 /replay [频道ID]")
+			return
+		}
+		channelID = ref.ID
+	}
+
+	statusMsg := p.sendBotMessage(bot, msg.Chat.ID, fmt.Sprintf("🎞️ 正在回放: %s ...", doc.FileName))
+	if statusMsg == nil {
+		return
+	}
+
+	replayDir := filepath.Join(p.ext.Config().DataDir, "replay")
+	if err := os.MkdirAll(replayDir, 0755); err != nil {
+		p.updateBotMessage(bot, statusMsg.Chat.ID, statusMsg.MessageID, "❌ 创建回放目录失败: "+err.Error())
+		return
+	}
+	name := strings.TrimSuffix(doc.FileName, filepath.Ext(doc.FileName))
+	exportPath := filepath.Join(replayDir, doc.FileName)
+	if err := downloadBotFile(bot, doc.FileID, exportPath); err != nil {
+		fmt.Printf("❌ 下载回放文件失败: %v\n", err)
+		p.updateBotMessage(bot, statusMsg.Chat.ID, statusMsg.MessageID, "❌ 下载文件失败: "+err.Error())
+		return
+	}
+	defer os.Remove(exportPath)
+
+	report, err := p.replayExport(ctx, exportPath, channelID)
+	if err != nil {
+		fmt.Printf("❌ 回放失败: %v\n", err)
+		p.updateBotMessage(bot, statusMsg.Chat.ID, statusMsg.MessageID, "❌ 回放失败: "+err.Error())
+		return
+	}
+
+	text := report.Summary()
+	recordsPath := filepath.Join(replayDir, fmt.Sprintf("%s-%s.jsonl", name, time.Now().Format("20060102-150405")))
+	if err := report.WriteRecords(recordsPath); err != nil {
+		fmt.Printf("⚠️  保存回放记录失败: %v\n", err)
+	} else {
+		text += "\n• 决策记录: " + recordsPath
+	}
+	fmt.Printf("🎞️ 回放完成 (file=%s, messages=%d, subscriptions=%d, nodes=%d)\n", doc.FileName, report.Messages, report.Subscriptions, report.Nodes)
+	p.updateBotMessage(bot, statusMsg.Chat.ID, statusMsg.MessageID, text)
+}
+
+// downloadBotFile 下载 Bot 收到的文件
+func downloadBotFile(bot *tgbotapi.BotAPI, fileID string, path string) error {
+	file, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return fmt.Errorf("获取文件失败: %w", err)
+	}
+	resp, err := http.Get(file.Link(bot.Token))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		os.Remove(path)
+		return err
+	}
+	return out.Close()
+}
+
+// runReplayCommand 命令行离线回放（不连接 Telegram）：
+//
+//	tdl-msgproce replay [-config config.yaml] [-channel ID] [-out records.jsonl] export.json
+//
+// 通过 tdl 启动时默认读取扩展数据目录中的 config.yaml
+func runReplayCommand(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	configPath := fs.String("config", "", "配置文件路径（默认使用扩展数据目录或当前目录的 config.yaml）")
+	channel := fs.String("channel", "", "按该频道的规则回放（默认使用导出文件中的频道ID）")
+	out := fs.String("out", "", "决策记录输出路径（JSON Lines）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("用法: replay [-config config.yaml] [-channel ID] [-out records.jsonl] export.json")
+	}
+
+	dataDir := extensionDataDir()
+	if *configPath == "" {
+		*configPath = filepath.Join(dataDir, "config.yaml")
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("配置加载失败: %w", err)
+	}
+	resolveConfiguredPeersOffline(config)
+
+	var channelID int64
+	if *channel != "" {
+		ref := parsePeerRef(*channel)
+		if ref.Kind != peerRefID {
+			return fmt.Errorf("离线回放只支持数字频道ID: %s", *channel)
+		}
+		channelID = ref.ID
+	}
+
+	p := &MessageProcessor{
+		config:    config,
+		linkRegex: buildLinkRegex(config),
+		subAPI:    NewSubscriptionClient(config.Monitor.SubscriptionAPI.AddURL, config.Monitor.SubscriptionAPI.ApiKey),
+	}
+	p.sinks = NewSinkRegistry(p, dataDir)
+
+	report, err := p.replayExport(context.Background(), fs.Arg(0), channelID)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report.Summary())
+	if *out != "" {
+		if err := report.WriteRecords(*out); err != nil {
+			return fmt.Errorf("保存决策记录失败: %w", err)
+		}
+		fmt.Printf("💾 决策记录已保存: %s (%d 条)\n", *out, len(report.Records))
+	}
+	return nil
+}
+
+// extensionDataDir 通过 tdl 启动时返回扩展数据目录，否则返回当前目录
+func extensionDataDir() string {
+	envFile := os.Getenv(extension.EnvKey)
+	if envFile == "" {
+		return "."
+	}
+	var env extension.Env
+	if data, err := os.ReadFile(envFile); err == nil && json.Unmarshal(data, &env) == nil && env.DataDir != "" {
+		return env.DataDir
+	}
+	return "."
+}
+
+// resolveConfiguredPeersOffline 不连接 Telegram 解析配置中的频道（只支持数字ID，用户名和邀请链接会被忽略）
+func resolveConfiguredPeersOffline(config *Config) {
+	overrides := make(map[int64]*ChannelEntry)
+	var channels []int64
+	for i := range config.Monitor.ChannelRefs {
+		entry := &config.Monitor.ChannelRefs[i]
+		ref := parsePeerRef(entry.Ref)
+		if ref.Kind != peerRefID {
+			fmt.Printf("⚠️  离线回放无法解析频道 %q，其频道规则不生效\n", entry.Ref)
+			continue
+		}
+		channels = append(channels, ref.ID)
+		if entry.HasOverrides() {
+			overrides[ref.ID] = entry
+		}
+	}
+	config.Monitor.Channels = channels
+	config.Monitor.ChannelOverrides = overrides
+
+	var whitelist []int64
+	for _, raw := range config.Monitor.WhitelistRefs {
+		if ref := parsePeerRef(raw); ref.Kind == peerRefID {
+			whitelist = append(whitelist, ref.ID)
+		}
+	}
+	config.Monitor.WhitelistChannels = whitelist
+}
@@ -0,0 +1,98 @@
+// tdl-msgproce - 离线回放测试
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestReplayExport(t *testing.T) {
+	tests := []struct {
+		name          string
+		channelID     int64 // 0 表示使用导出文件中的频道ID
+		decisions     map[int]string
+		subscriptions int
+		nodes         int
+		protocols     map[string]int
+	}{
+		{
+			name: "全局规则",
+			decisions: map[int]string{
+				1:  dryRunStageFormat,
+				2:  "submit",
+				3:  dryRunStageContent,
+				4:  "submit",
+				5:  "submit", // 文本片段数组中的超链接
+				6:  dryRunStageNodes,
+				7:  dryRunStageBlack,
+				8:  dryRunStageNodes, // vless 缺少 UUID
+				9:  dryRunStageEmpty,
+				10: "submit", // --raw 导出的 message 字段
+			},
+			subscriptions: 2,
+			nodes:         3,
+			protocols:     map[string]int{"https": 2, "trojan": 1, "vmess": 1, "hysteria2": 1},
+		},
+		{
+			name:      "频道只接受 trojan",
+			channelID: 1002,
+			// 频道协议同时替换 subs / ss 格式前缀，不含 trojan 的消息在格式检查阶段跳过
+			decisions: map[int]string{
+				1:  dryRunStageFormat,
+				2:  dryRunStageFormat,
+				3:  dryRunStageFormat,
+				4:  "submit", // 只提交 trojan，vmess 被协议过滤
+				5:  dryRunStageFormat,
+				6:  dryRunStageNodes,
+				7:  dryRunStageFormat,
+				8:  dryRunStageFormat,
+				9:  dryRunStageEmpty,
+				10: dryRunStageFormat,
+			},
+			nodes:     1,
+			protocols: map[string]int{"trojan": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestReplayProcessor(t)
+			report, err := p.replayExport(context.Background(), "testdata/tdl_export.json", tt.channelID)
+			if err != nil {
+				t.Fatalf("replayExport: %v", err)
+			}
+
+			wantChannel := tt.channelID
+			if wantChannel == 0 {
+				wantChannel = 1001
+			}
+			if report.ChannelID != wantChannel || report.Messages != len(tt.decisions) {
+				t.Errorf("ChannelID=%d Messages=%d, want %d %d", report.ChannelID, report.Messages, wantChannel, len(tt.decisions))
+			}
+
+			decisions := make(map[int]string)
+			for _, record := range report.Records {
+				if record.Decision == "submit" {
+					decisions[record.MessageID] = record.Decision
+				} else {
+					decisions[record.MessageID] = record.SkippedBy
+				}
+			}
+			if !reflect.DeepEqual(decisions, tt.decisions) {
+				for id, want := range tt.decisions {
+					if decisions[id] != want {
+						t.Errorf("消息 %d: %q, want %q", id, decisions[id], want)
+					}
+				}
+			}
+
+			if report.Subscriptions != tt.subscriptions || report.Nodes != tt.nodes {
+				t.Errorf("订阅=%d 节点=%d, want %d %d", report.Subscriptions, report.Nodes, tt.subscriptions, tt.nodes)
+			}
+			if !reflect.DeepEqual(report.Protocols, tt.protocols) {
+				t.Errorf("Protocols = %v, want %v", report.Protocols, tt.protocols)
+			}
+		})
+	}
+}
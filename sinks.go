@@ -0,0 +1,524 @@
+// tdl-msgproce - 可插拔的输出目标（订阅 API、本地文件、Telegram 会话）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	sinkTypeAPI      = "api"      // 订阅 API（与 subscription_api 相同的接口）
+	sinkTypeFile     = "file"     // 追加写入本地文件
+	sinkTypeTelegram = "telegram" // 发送到 Telegram 会话
+
+	telegramSinkMaxLength = 4000 // 单条消息最大长度（Telegram 限制 4096）
+)
+
+// SinkConfig monitor.sinks 中的单个输出目标
+type SinkConfig struct {
+	Name      string   `yaml:"name"`      // 名称（频道规则中的 sink 引用此名称，api 为保留名称）
+	Type      string   `yaml:"type"`      // api / file / telegram
+	Enabled   bool     `yaml:"enabled"`   // 是否启用
+	Protocols []string `yaml:"protocols"` // 只接收这些协议的链接（留空接收全部，订阅链接为 http/https）
+
+	AddURL string `yaml:"add_url"` // api: 添加订阅的完整 URL
+	ApiKey string `yaml:"api_key"` // api: API 密钥
+	Path   string `yaml:"path"`    // file: 文件路径；collection: 输出目录（相对路径基于 DataDir）
+	Chat   string `yaml:"chat"`    // telegram: 目标会话（数字ID、@username 或 t.me 链接）
+	MaxAge string `yaml:"max_age"` // collection: 节点保留时间（如 72h，留空默认 72h）
+}
+
+// Sink 输出目标
+// Submit 对订阅链接每次只传入一个链接，对节点传入一批
+type Sink interface {
+	Name() string
+	Accepts(link string) bool
+	Submit(ctx context.Context, links []string, isNode bool) (*SubmitResult, error)
+}
+
+// Retractor 可选接口：支持撤回已提交链接的输出目标（编辑消息移除链接时调用），返回撤回数量
+type Retractor interface {
+	Retract(ctx context.Context, links []string) (int, error)
+}
+
+// sinkBase 输出目标的公共部分：名称和协议白名单
+type sinkBase struct {
+	name      string
+	protocols []string
+}
+
+func (b sinkBase) Name() string { return b.name }
+
+func (b sinkBase) Accepts(link string) bool { return protocolAllowed(link, b.protocols) }
+
+// localResult 本地输出（文件、Telegram）的提交结果，失败可由发件箱重试
+func localResult(err error) (*SubmitResult, error) {
+	if err != nil {
+		return &SubmitResult{Status: SubmitFailed, Attempts: 1}, err
+	}
+	return &SubmitResult{Status: SubmitAdded, Attempts: 1}, nil
+}
+
+// apiSink 提交到订阅 API
+type apiSink struct {
+	sinkBase
+	client *SubscriptionClient
+}
+
+func (s *apiSink) Submit(ctx context.Context, links []string, isNode bool) (*SubmitResult, error) {
+	if isNode {
+		return s.client.SubmitNodes(ctx, links)
+	}
+	return s.client.SubmitLink(ctx, links[0], false)
+}
+
+// fileSink 每行一个链接追加写入本地文件
+type fileSink struct {
+	sinkBase
+	path string
+	mu   sync.Mutex
+}
+
+func (s *fileSink) Submit(ctx context.Context, links []string, isNode bool) (*SubmitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return localResult(fmt.Errorf("创建目录失败: %w", err))
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return localResult(fmt.Errorf("打开文件失败: %w", err))
+	}
+	if _, err := f.WriteString(strings.Join(links, "\n") + "\n"); err != nil {
+		f.Close()
+		return localResult(fmt.Errorf("写入文件失败: %w", err))
+	}
+	return localResult(f.Close())
+}
+
+// telegramSink 以文本消息发送到 Telegram 会话（使用 tdl 用户账号）
+type telegramSink struct {
+	sinkBase
+	chat string
+	p    *MessageProcessor
+
+	mu     sync.Mutex
+	peer   tg.InputPeerClass // 首次发送时解析
+	peerID int64             // 解析后的会话ID（监听时跳过该会话）
+}
+
+func (s *telegramSink) resolve(ctx context.Context) (tg.InputPeerClass, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.peer != nil {
+		return s.peer, nil
+	}
+	peer, err := s.p.peers.ResolveRef(ctx, s.chat, "")
+	if err != nil {
+		return nil, fmt.Errorf("解析会话 %q 失败: %w", s.chat, err)
+	}
+	s.peer = peer.InputPeer()
+	s.peerID = peer.ID
+	return s.peer, nil
+}
+
+// chatID 返回解析后的会话ID（尚未发送过时为 0）
+func (s *telegramSink) chatID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peerID
+}
+
+// telegramChunk 一条待发送的消息及其包含的链接
+type telegramChunk struct {
+	text  string
+	links []string
+}
+
+func (s *telegramSink) Submit(ctx context.Context, links []string, isNode bool) (*SubmitResult, error) {
+	peer, err := s.resolve(ctx)
+	if err != nil {
+		return localResult(err)
+	}
+
+	header := "🔗 订阅"
+	if isNode {
+		header = fmt.Sprintf("🔗 节点 (%d)", len(links))
+	}
+
+	// 按长度拆分为多条消息
+	var chunks []telegramChunk
+	current := telegramChunk{text: header}
+	for _, link := range links {
+		if current.text != "" && len(current.text)+1+len(link) > telegramSinkMaxLength {
+			chunks = append(chunks, current)
+			current = telegramChunk{}
+		}
+		if current.text != "" {
+			current.text += "\n"
+		}
+		current.text += link
+		current.links = append(current.links, link)
+	}
+	chunks = append(chunks, current)
+
+	for i, chunk := range chunks {
+		_, err := s.p.api.MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+			Peer:      peer,
+			Message:   chunk.text,
+			RandomID:  time.Now().UnixNano(),
+			NoWebpage: true,
+		})
+		if err != nil {
+			// 已发出部分分段时只把未发出的链接交给发件箱重试，避免重复发送
+			result, err := localResult(fmt.Errorf("发送消息失败 (已发送 %d/%d 段): %w", i, len(chunks), err))
+			if i > 0 {
+				for _, rest := range chunks[i:] {
+					result.Undelivered = append(result.Undelivered, rest.links...)
+				}
+			}
+			return result, err
+		}
+	}
+	return localResult(nil)
+}
+
+// SinkStats 单个输出目标的提交统计
+type SinkStats struct {
+	Submitted int64 // 成功提交的链接数
+	Failed    int64 // 提交失败的链接数
+}
+
+// SinkRegistry 已配置的输出目标
+type SinkRegistry struct {
+	sinks  []Sink
+	byName map[string]Sink
+
+	mu    sync.Mutex
+	stats map[string]*SinkStats
+}
+
+// NewSinkRegistry 根据配置创建输出目标；subscription_api 作为名为 api 的默认输出
+func NewSinkRegistry(p *MessageProcessor, dataDir string) *SinkRegistry {
+	r := &SinkRegistry{
+		byName: make(map[string]Sink),
+		stats:  make(map[string]*SinkStats),
+	}
+	if p.subAPI.Enabled() {
+		r.add(&apiSink{
+			sinkBase: sinkBase{name: defaultSink, protocols: p.config.Monitor.SubscriptionAPI.Protocols},
+			client:   p.subAPI,
+		})
+	}
+
+	for _, cfg := range p.config.Monitor.Sinks {
+		if !cfg.Enabled {
+			continue
+		}
+		base := sinkBase{name: cfg.Name, protocols: cfg.Protocols}
+		switch cfg.Type {
+		case sinkTypeAPI:
+			r.add(&apiSink{sinkBase: base, client: NewSubscriptionClient(cfg.AddURL, cfg.ApiKey)})
+		case sinkTypeFile:
+			path := cfg.Path
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dataDir, path)
+			}
+			r.add(&fileSink{sinkBase: base, path: path})
+		case sinkTypeTelegram:
+			r.add(&telegramSink{sinkBase: base, chat: cfg.Chat, p: p})
+		case sinkTypeCollection:
+			dir := firstNonEmpty(cfg.Path, defaultCollectionDir)
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(dataDir, dir)
+			}
+			maxAge := defaultCollectionMaxAge
+			if cfg.MaxAge != "" {
+				maxAge, _ = time.ParseDuration(cfg.MaxAge) // 已在加载配置时校验
+			}
+			r.add(newCollectionSink(base, dir, maxAge))
+		}
+	}
+	return r
+}
+
+func (r *SinkRegistry) add(sink Sink) {
+	r.sinks = append(r.sinks, sink)
+	r.byName[sink.Name()] = sink
+	r.stats[sink.Name()] = &SinkStats{}
+}
+
+// Get 按名称查找输出目标
+func (r *SinkRegistry) Get(name string) (Sink, bool) {
+	sink, ok := r.byName[name]
+	return sink, ok
+}
+
+// ForRules 返回频道规则对应的输出目标：未指定时为全部已启用的输出
+func (r *SinkRegistry) ForRules(rules ChannelRules) []Sink {
+	if len(rules.Sinks) == 0 {
+		return r.sinks
+	}
+	var sinks []Sink
+	for _, name := range rules.Sinks {
+		if sink, ok := r.byName[name]; ok {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+// Names 返回所有输出目标名称
+func (r *SinkRegistry) Names() []string {
+	names := make([]string, 0, len(r.sinks))
+	for _, sink := range r.sinks {
+		names = append(names, sink.Name())
+	}
+	return names
+}
+
+// TargetsChat 会话是否为 telegram 输出目标发送链接的会话（不监听，避免重复提交自己发出的链接）
+func (r *SinkRegistry) TargetsChat(peerID int64) bool {
+	for _, sink := range r.sinks {
+		if ts, ok := sink.(*telegramSink); ok && ts.chatID() == peerID {
+			return true
+		}
+	}
+	return false
+}
+
+// record 记录一次提交结果
+func (r *SinkRegistry) record(name string, ok bool, count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, exists := r.stats[name]
+	if !exists {
+		return
+	}
+	if ok {
+		s.Submitted += int64(count)
+	} else {
+		s.Failed += int64(count)
+	}
+}
+
+// formatStats 输出目标统计文本（用于 /status）
+func (r *SinkRegistry) formatStats() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.stats) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(r.stats))
+	for name := range r.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("\n\n📤 输出目标:")
+	for _, name := range names {
+		s := r.stats[name]
+		sb.WriteString(fmt.Sprintf("\n• %s: 成功 %d, 失败 %d", name, s.Submitted, s.Failed))
+	}
+	return sb.String()
+}
+
+// sinkItem 待提交的链接及其来源（用于统计归属和发件箱）
+type sinkItem struct {
+	Link      string
+	ChannelID int64
+	MessageID int
+}
+
+// newSinkItems 为同一条消息中的链接构建提交项
+func newSinkItems(links []string, channelID int64, msgID int) []sinkItem {
+	items := make([]sinkItem, 0, len(links))
+	for _, link := range links {
+		items = append(items, sinkItem{Link: link, ChannelID: channelID, MessageID: msgID})
+	}
+	return items
+}
+
+// sinkItemLinks 提取提交项中的链接
+func sinkItemLinks(items []sinkItem) []string {
+	links := make([]string, 0, len(items))
+	for _, item := range items {
+		links = append(links, item.Link)
+	}
+	return links
+}
+
+// describeSources 来源描述（用于日志）：单一频道时输出频道ID，否则输出频道数
+func describeSources(items []sinkItem) string {
+	channels := make(map[int64]bool)
+	for _, item := range items {
+		channels[item.ChannelID] = true
+	}
+	if len(channels) == 1 {
+		return fmt.Sprintf("频道: %d", items[0].ChannelID)
+	}
+	return fmt.Sprintf("频道: %d个", len(channels))
+}
+
+// submitToSinks 将链接分发到各输出目标（按各自的协议白名单筛选），各目标独立记录成败
+// 失败的提交按来源消息拆分后进入发件箱，返回至少被一个目标成功接收的提交项（保持原顺序）
+func (p *MessageProcessor) submitToSinks(ctx context.Context, sinks []Sink, items []sinkItem, isNode bool, msgTypeLabel string) []sinkItem {
+	linkType := "订阅"
+	if isNode {
+		linkType = "节点"
+	}
+
+	delivered := make(map[int]bool)
+	for _, sink := range sinks {
+		var accepted []int
+		var links []string
+		for i, item := range items {
+			if sink.Accepts(item.Link) {
+				accepted = append(accepted, i)
+				links = append(links, item.Link)
+			}
+		}
+		if len(accepted) == 0 {
+			continue
+		}
+		acceptedItems := make([]sinkItem, 0, len(accepted))
+		for _, i := range accepted {
+			acceptedItems = append(acceptedItems, items[i])
+		}
+		sources := describeSources(acceptedItems)
+
+		result, err := sink.Submit(ctx, links, isNode)
+		p.sinks.record(sink.Name(), result.OK(), len(links))
+		if !result.OK() {
+			fmt.Printf("❌ %s-%s提交到 %s 失败 (数量=%d, %s, 尝试次数=%d): %v\n", msgTypeLabel, linkType, sink.Name(), len(links), sources, result.Attempts, err)
+			p.saveItemsToOutbox(sink.Name(), result, err, undeliveredItems(acceptedItems, result), isNode)
+			continue
+		}
+
+		switch {
+		case result.Status == SubmitExists:
+			fmt.Printf("⚠️  %s-%s已存在 (输出=%s, 数量=%d, %s)\n", msgTypeLabel, linkType, sink.Name(), len(links), sources)
+		case result.Tested():
+			fmt.Printf("✅ %s-%s检测完成 (输出=%s, 数量=%d, %s)\n", msgTypeLabel, linkType, sink.Name(), len(links), result.Summary())
+			if result.Response.Timeout != nil && *result.Response.Timeout {
+				fmt.Printf("⚠️  %s检测超时 (输出=%s, warning=%s)\n", linkType, sink.Name(), result.Response.Warning)
+			}
+		default:
+			// fmt.Printf("[DEBUG] %s-%s已提交 (输出=%s, 数量=%d)\n", msgTypeLabel, linkType, sink.Name(), len(links))
+		}
+		for _, i := range accepted {
+			delivered[i] = true
+		}
+	}
+
+	var result []sinkItem
+	for i, item := range items {
+		if delivered[i] {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// retractFromSinks 通知支持撤回的输出目标移除链接（按各自的协议白名单筛选）
+// 撤回的节点同时从指纹缓存中移除，之后再次出现时可以重新提交
+func (p *MessageProcessor) retractFromSinks(ctx context.Context, sinks []Sink, links []string, msgTypeLabel string) {
+	for _, sink := range sinks {
+		retractor, ok := sink.(Retractor)
+		if !ok {
+			continue
+		}
+		var accepted []string
+		for _, link := range links {
+			if sink.Accepts(link) {
+				accepted = append(accepted, link)
+			}
+		}
+		if len(accepted) == 0 {
+			continue
+		}
+
+		n, err := retractor.Retract(ctx, accepted)
+		if err != nil {
+			fmt.Printf("❌ %s撤回链接失败 (输出=%s, 数量=%d): %v\n", msgTypeLabel, sink.Name(), len(accepted), err)
+			continue
+		}
+		if n > 0 {
+			fmt.Printf("↩️  %s已撤回链接 (输出=%s, 数量=%d)\n", msgTypeLabel, sink.Name(), n)
+		}
+		p.nodeDedup.Forget(accepted)
+	}
+}
+
+// validateSinkConfigs 检查输出目标配置并登记可用名称，配置错误的输出目标被禁用
+func validateSinkConfigs(config *Config) {
+	knownSinks := map[string]bool{defaultSink: true}
+	config.Monitor.SinkNames = knownSinks
+	for i := range config.Monitor.Sinks {
+		cfg := &config.Monitor.Sinks[i]
+		if !cfg.Enabled {
+			continue
+		}
+
+		var problem string
+		switch {
+		case cfg.Name == "":
+			problem = "缺少 name"
+		case knownSinks[cfg.Name]:
+			problem = "名称重复或使用了保留名称 api"
+		case cfg.Type == sinkTypeAPI && cfg.AddURL == "":
+			problem = "api 类型需要 add_url"
+		case cfg.Type == sinkTypeFile && cfg.Path == "":
+			problem = "file 类型需要 path"
+		case cfg.Type == sinkTypeTelegram && cfg.Chat == "":
+			problem = "telegram 类型需要 chat"
+		case cfg.Type == sinkTypeTelegram && monitorsRef(config, cfg.Chat):
+			problem = fmt.Sprintf("chat %q 同时是监听频道，发送的链接会被重复处理", cfg.Chat)
+		case cfg.Type == sinkTypeCollection && cfg.MaxAge != "" && !validDuration(cfg.MaxAge):
+			problem = fmt.Sprintf("max_age %q 无效（例如 72h）", cfg.MaxAge)
+		case cfg.Type != sinkTypeAPI && cfg.Type != sinkTypeFile && cfg.Type != sinkTypeTelegram && cfg.Type != sinkTypeCollection:
+			problem = fmt.Sprintf("未知类型 %q（可选 api / file / telegram / collection）", cfg.Type)
+		}
+		if problem != "" {
+			fmt.Printf("⚠️  输出目标 #%d (%s) 配置无效，已禁用: %s\n", i+1, cfg.Name, problem)
+			cfg.Enabled = false
+			continue
+		}
+		knownSinks[cfg.Name] = true
+	}
+}
+
+// monitorsRef 引用是否与某个监听频道相同
+func monitorsRef(config *Config, raw string) bool {
+	ref := parsePeerRef(raw)
+	for _, entry := range config.Monitor.ChannelRefs {
+		if ref.Same(parsePeerRef(entry.Ref)) {
+			return true
+		}
+	}
+	return false
+}
+
+// validDuration 是否为有效的正时长
+func validDuration(s string) bool {
+	d, err := time.ParseDuration(s)
+	return err == nil && d > 0
+}
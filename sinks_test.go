@@ -0,0 +1,110 @@
+// tdl-msgproce - 输出目标测试
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// fakeSendInvoker 模拟 messages.sendMessage：从第 failFrom 次调用起返回错误（0 表示总是成功）
+type fakeSendInvoker struct {
+	failFrom int
+	sent     []string
+}
+
+func (f *fakeSendInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	req, ok := input.(*tg.MessagesSendMessageRequest)
+	if !ok {
+		return errors.New("unexpected request")
+	}
+	if f.failFrom > 0 && len(f.sent)+1 >= f.failFrom {
+		return errors.New("FLOOD_WAIT_30")
+	}
+	f.sent = append(f.sent, req.Message)
+	return nil
+}
+
+func TestTelegramSinkPartialFailure(t *testing.T) {
+	// 每个链接约 1500 字符，每条消息最多容纳 2 个
+	var links []string
+	for i := 0; i < 5; i++ {
+		links = append(links, "trojan://pw@a"+strings.Repeat("x", 1500)+".com:"+string(rune('1'+i))+"443")
+	}
+
+	invoker := &fakeSendInvoker{failFrom: 2}
+	sink := &telegramSink{
+		sinkBase: sinkBase{name: "notify"},
+		p:        &MessageProcessor{api: tg.NewClient(invoker)},
+		peer:     &tg.InputPeerSelf{},
+	}
+
+	result, err := sink.Submit(context.Background(), links, true)
+	if err == nil || result.OK() || !result.Retryable() {
+		t.Fatalf("Submit = %+v, %v; want retryable failure", result, err)
+	}
+	if len(invoker.sent) != 1 {
+		t.Fatalf("sent %d chunks, want 1", len(invoker.sent))
+	}
+	// 第一段（header + 2 个链接）已发出，只有剩余链接交给发件箱
+	if want := links[2:]; !reflect.DeepEqual(result.Undelivered, want) {
+		t.Errorf("Undelivered = %d links, want %d", len(result.Undelivered), len(want))
+	}
+
+	items := newSinkItems(links, 1001, 7)
+	if kept := undeliveredItems(items, result); !reflect.DeepEqual(sinkItemLinks(kept), links[2:]) {
+		t.Errorf("undeliveredItems = %v", sinkItemLinks(kept))
+	}
+
+	// 首段即失败时全部未送达
+	invoker = &fakeSendInvoker{failFrom: 1}
+	sink.p.api = tg.NewClient(invoker)
+	result, _ = sink.Submit(context.Background(), links, true)
+	if len(result.Undelivered) != 0 || len(undeliveredItems(items, result)) != len(items) {
+		t.Errorf("首段失败: Undelivered = %v, want 全部重试", result.Undelivered)
+	}
+}
+
+func TestValidateSinkConfigsMonitoredChat(t *testing.T) {
+	cfg := &Config{}
+	cfg.Monitor.ChannelRefs = []ChannelEntry{{Ref: "@Source_Channel"}, {Ref: "-1001234567890"}}
+	cfg.Monitor.Sinks = []SinkConfig{
+		{Name: "loop", Type: sinkTypeTelegram, Enabled: true, Chat: "https://t.me/source_channel"},
+		{Name: "loop_id", Type: sinkTypeTelegram, Enabled: true, Chat: "-1001234567890"},
+		{Name: "notify", Type: sinkTypeTelegram, Enabled: true, Chat: "@collect"},
+	}
+	validateSinkConfigs(cfg)
+
+	var enabled []string
+	for _, sink := range cfg.Monitor.Sinks {
+		if sink.Enabled {
+			enabled = append(enabled, sink.Name)
+		}
+	}
+	if want := []string{"notify"}; !reflect.DeepEqual(enabled, want) {
+		t.Errorf("enabled sinks = %v, want %v", enabled, want)
+	}
+}
+
+func TestSinkRegistryTargetsChat(t *testing.T) {
+	r := &SinkRegistry{byName: make(map[string]Sink), stats: make(map[string]*SinkStats)}
+	r.add(&fileSink{sinkBase: sinkBase{name: "archive"}})
+	r.add(&telegramSink{sinkBase: sinkBase{name: "notify"}, peerID: 555})
+
+	if !r.TargetsChat(555) || r.TargetsChat(1001) {
+		t.Errorf("TargetsChat(555)=%v TargetsChat(1001)=%v", r.TargetsChat(555), r.TargetsChat(1001))
+	}
+
+	cfg := &Config{}
+	cfg.Monitor.Enabled = true
+	cfg.Monitor.Channels = []int64{555, 1001}
+	p := &MessageProcessor{config: cfg, sinks: r}
+	if p.isMonitoredPeer(555) || !p.isMonitoredPeer(1001) {
+		t.Errorf("输出目标会话仍被监听")
+	}
+}
@@ -0,0 +1,234 @@
+// tdl-msgproce - 订阅链接本地预检（下载并识别订阅内容格式）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultSubCheckTimeout   = 15 * time.Second // 默认下载超时
+	defaultSubCheckMaxSizeKB = 4096             // 默认最大读取大小（KB）
+)
+
+// 订阅内容格式
+const (
+	subFormatBase64  = "base64"   // base64 编码的分享链接列表
+	subFormatPlain   = "plain"    // 明文分享链接列表
+	subFormatClash   = "clash"    // Clash YAML
+	subFormatSingBox = "sing-box" // sing-box JSON
+	subFormatHTML    = "html"     // 网页（登录页、面板首页等）
+	subFormatEmpty   = "empty"    // 空响应
+	subFormatInvalid = "invalid"  // 无法识别的内容（图片、错误信息等）
+	subFormatHTTP    = "http"     // 上游返回 4xx
+	subFormatUnknown = "unknown"  // 网络错误或 5xx，无法判断
+)
+
+// SubCheckResult 订阅预检结果
+type SubCheckResult struct {
+	Format     string       // 识别出的内容格式
+	Nodes      int          // 识别出的节点数
+	StatusCode int          // 上游 HTTP 状态码（网络错误时为 0）
+	UserInfo   *SubUserInfo // Subscription-Userinfo 响应头（未返回时为 nil）
+	Dead       string       // 订阅失效原因（已过期、流量耗尽）
+	Err        error
+}
+
+// Valid 是否为可提交的订阅：识别出至少一个节点，或因网络问题无法判断（交给订阅 API 处理）
+func (r SubCheckResult) Valid() bool {
+	return r.Nodes > 0 || r.Format == subFormatUnknown
+}
+
+// String 预检结果摘要
+func (r SubCheckResult) String() string {
+	if r.Dead != "" {
+		return fmt.Sprintf("%s, %s", r.Dead, r.UserInfo)
+	}
+	switch r.Format {
+	case subFormatUnknown:
+		return fmt.Sprintf("无法判断: %v", r.Err)
+	case subFormatHTTP:
+		return fmt.Sprintf("HTTP %d", r.StatusCode)
+	}
+	return fmt.Sprintf("格式=%s, 节点=%d", r.Format, r.Nodes)
+}
+
+// SubscriptionChecker 使用与 ProxyServer 相同的 clash UA 下载订阅并识别内容格式
+type SubscriptionChecker struct {
+	client  *http.Client
+	maxSize int64
+}
+
+// NewSubscriptionChecker 创建订阅预检器
+func NewSubscriptionChecker(timeout time.Duration, maxSizeKB int) *SubscriptionChecker {
+	if timeout <= 0 {
+		timeout = defaultSubCheckTimeout
+	}
+	if maxSizeKB <= 0 {
+		maxSizeKB = defaultSubCheckMaxSizeKB
+	}
+	return &SubscriptionChecker{
+		client:  &http.Client{Timeout: timeout},
+		maxSize: int64(maxSizeKB) * 1024,
+	}
+}
+
+// Check 下载订阅并识别格式和节点数
+func (c *SubscriptionChecker) Check(ctx context.Context, link string) SubCheckResult {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return SubCheckResult{Format: subFormatInvalid, Err: err}
+	}
+	req.Header.Set("User-Agent", subscriptionUserAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return SubCheckResult{Format: subFormatUnknown, Err: err}
+	}
+	defer resp.Body.Close()
+
+	result := SubCheckResult{StatusCode: resp.StatusCode, UserInfo: parseSubUserInfo(resp.Header)}
+	switch {
+	case resp.StatusCode >= 500:
+		result.Format = subFormatUnknown
+		result.Err = fmt.Errorf("HTTP %d", resp.StatusCode)
+		return result
+	case resp.StatusCode >= 400:
+		result.Format = subFormatHTTP
+		return result
+	}
+
+	// 超过大小上限的部分直接截断，只影响识别出的节点数
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxSize))
+	if err != nil {
+		result.Format = subFormatUnknown
+		result.Err = err
+		return result
+	}
+	result.Format, result.Nodes = classifySubscription(body)
+	return result
+}
+
+// classifySubscription 识别订阅内容：sing-box JSON、Clash YAML、明文或 base64 分享链接列表
+func classifySubscription(body []byte) (string, int) {
+	body = bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")))
+	if len(body) == 0 {
+		return subFormatEmpty, 0
+	}
+
+	head := strings.ToLower(string(body[:min(len(body), 512)]))
+	if strings.HasPrefix(head, "<") && (strings.Contains(head, "<html") || strings.Contains(head, "<!doctype") || strings.Contains(head, "<head")) {
+		return subFormatHTML, 0
+	}
+
+	if body[0] == '{' {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(body, &doc); err == nil {
+			if _, ok := doc["outbounds"]; ok {
+				return subFormatSingBox, len(convertStructuredNodes(body))
+			}
+			return subFormatInvalid, 0
+		}
+	}
+
+	if n := countNodeLines(string(body)); n > 0 {
+		return subFormatPlain, n
+	}
+
+	if decoded, err := decodeBase64Loose(strings.Join(strings.Fields(string(body)), "")); err == nil {
+		if n := countNodeLines(string(decoded)); n > 0 {
+			return subFormatBase64, n
+		}
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(body, &doc); err == nil {
+		if _, ok := doc["proxies"]; ok {
+			return subFormatClash, len(convertStructuredNodes(body))
+		}
+	}
+	return subFormatInvalid, 0
+}
+
+// countNodeLines 统计文本中可解析的分享链接行数
+func countNodeLines(text string) int {
+	count := 0
+	for _, line := range strings.Split(text, "\n") {
+		if _, err := ParseProxyNode(strings.TrimSpace(line)); err == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// precheckSubscription 检查订阅链接是否应提交，并记录格式、流量与到期信息
+//   - 订阅记录中已确认失效（过期或流量耗尽）的链接直接跳过
+//   - 启用订阅预检或流量记录时下载订阅，记录 Subscription-Userinfo
+//   - 启用订阅预检时只提交识别出节点的订阅
+func (p *MessageProcessor) precheckSubscription(ctx context.Context, link string, channelID int64) (SubCheckResult, bool) {
+	if p.subRegistry != nil {
+		if reason, info := p.subRegistry.KnownDead(link, p.subRecheck); reason != "" {
+			p.recordDeadSubscription(channelID)
+			result := SubCheckResult{Format: subFormatUnknown, UserInfo: info, Dead: reason}
+			fmt.Printf("⏭️  跳过已失效订阅 (%s): %s\n", result, link)
+			return result, false
+		}
+	}
+	if p.subChecker == nil {
+		return SubCheckResult{}, true
+	}
+
+	result := p.subChecker.Check(ctx, link)
+	if p.subRegistry != nil && result.Format != subFormatUnknown {
+		if result.Dead = p.subRegistry.Record(link, result.UserInfo, result.Format, result.Nodes); result.Dead != "" {
+			p.recordDeadSubscription(channelID)
+			fmt.Printf("🪫 订阅已失效，跳过提交 (%s): %s\n", result, link)
+			return result, false
+		}
+	}
+	if result.UserInfo != nil {
+		fmt.Printf("🧾 订阅流量信息 (%s): %s\n", result.UserInfo, link)
+	}
+	if !p.config.Monitor.Features.SubscriptionCheck.Enabled {
+		return result, true
+	}
+
+	valid := result.Valid()
+	if channelID != 0 {
+		p.stats.Update(channelID, func(s *ChannelStats) {
+			s.SubFormats[result.Format]++
+			if !valid {
+				s.SubRejected++
+			}
+		})
+	}
+
+	if !valid {
+		fmt.Printf("🚫 订阅预检未通过，跳过提交 (%s): %s\n", result, link)
+	} else if result.Format == subFormatUnknown {
+		fmt.Printf("⚠️  订阅预检无法判断，仍然提交 (%s): %s\n", result, link)
+	} else {
+		fmt.Printf("🔍 订阅预检通过 (%s): %s\n", result, link)
+	}
+	return result, valid
+}
+
+// recordDeadSubscription 统计被跳过的失效订阅（Bot 提交不计入频道统计）
+func (p *MessageProcessor) recordDeadSubscription(channelID int64) {
+	if channelID != 0 {
+		p.stats.Update(channelID, func(s *ChannelStats) { s.SubDead++ })
+	}
+}
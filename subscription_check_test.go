@@ -0,0 +1,56 @@
+// tdl-msgproce - 订阅预检格式识别测试
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestClassifySubscription(t *testing.T) {
+	shareLinks := "trojan://pw@a.com:443#A\nvless://b831381d-6324-4d53-ad4f-8cda48b30811@b.com:443?type=ws#B\n"
+
+	tests := []struct {
+		name   string
+		body   string
+		format string
+		nodes  int
+	}{
+		{"空响应", " \r\n", subFormatEmpty, 0},
+		{"HTML 登录页", "<!DOCTYPE html>\n<html><head><title>登录</title></head></html>", subFormatHTML, 0},
+		{"HTML 带 BOM", "\xef\xbb\xbf<html lang=\"zh\"><body>404</body></html>", subFormatHTML, 0},
+		{
+			"sing-box JSON",
+			`{"outbounds":[{"type":"trojan","tag":"A","server":"a.com","server_port":443,"password":"pw"},{"type":"direct","tag":"direct"}]}`,
+			subFormatSingBox, 1,
+		},
+		{"JSON 错误信息", `{"error":"token expired"}`, subFormatInvalid, 0},
+		{"明文链接列表", shareLinks, subFormatPlain, 2},
+		{"base64 链接列表", base64.StdEncoding.EncodeToString([]byte(shareLinks)), subFormatBase64, 2},
+		{"base64 分行", wrapLines(base64.StdEncoding.EncodeToString([]byte(shareLinks)), 20), subFormatBase64, 2},
+		{
+			"Clash YAML",
+			"port: 7890\nproxies:\n  - name: A\n    type: trojan\n    server: a.com\n    port: 443\n    password: pw\n  - name: B\n    type: ss\n    server: b.com\n    port: 8388\n    cipher: aes-256-gcm\n    password: pw\n",
+			subFormatClash, 2,
+		},
+		{"YAML 没有 proxies", "port: 7890\nmode: rule\n", subFormatInvalid, 0},
+		{"纯文本", "订阅已过期，请续费", subFormatInvalid, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, nodes := classifySubscription([]byte(tt.body))
+			if format != tt.format || nodes != tt.nodes {
+				t.Errorf("classifySubscription = (%s, %d), want (%s, %d)", format, nodes, tt.format, tt.nodes)
+			}
+		})
+	}
+}
+
+// wrapLines 按固定宽度换行（部分机场的 base64 订阅每 76 个字符换行）
+func wrapLines(s string, width int) string {
+	var out string
+	for len(s) > width {
+		out += s[:width] + "\n"
+		s = s[width:]
+	}
+	return out + s
+}
@@ -0,0 +1,277 @@
+// tdl-msgproce - 订阅 API 客户端（统一的提交、重试与响应解析）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	subscriptionAPITimeout     = 120 * time.Second // 单次请求超时（检测模式可能较慢）
+	subscriptionAPIMaxAttempts = 3                 // 5xx 或网络错误的最大尝试次数
+	subscriptionAPIBackoff     = 2 * time.Second   // 首次重试等待时间，之后每次翻倍
+)
+
+// SubscriptionRequest 订阅或节点请求结构
+type SubscriptionRequest struct {
+	SubURL string `json:"sub_url,omitempty"`
+	SS     string `json:"ss,omitempty"`
+	Test   bool   `json:"test"`
+}
+
+// SubscriptionResponse 订阅API响应结构
+type SubscriptionResponse struct {
+	Message     string `json:"message"`
+	Error       string `json:"error"`
+	SubURL      string `json:"sub_url"`
+	TestedNodes *int   `json:"tested_nodes,omitempty"`
+	PassedNodes *int   `json:"passed_nodes,omitempty"`
+	FailedNodes *int   `json:"failed_nodes,omitempty"`
+	AddedNodes  *int   `json:"added_nodes,omitempty"`
+	Duration    string `json:"duration,omitempty"`
+	Timeout     *bool  `json:"timeout,omitempty"`
+	Warning     string `json:"warning,omitempty"`
+}
+
+// SubmitStatus 提交结果分类
+type SubmitStatus int
+
+const (
+	SubmitAdded    SubmitStatus = iota // 200：已添加（或检测完成）
+	SubmitExists                       // 409：已存在，视为成功
+	SubmitRejected                     // 其他 4xx：API 拒绝，不重试
+	SubmitFailed                       // 网络错误、超时或 5xx，重试后仍失败
+)
+
+// SubmitResult 一次提交的结果
+type SubmitResult struct {
+	Status     SubmitStatus
+	StatusCode int                   // HTTP 状态码（未收到响应时为 0）
+	Response   *SubscriptionResponse // 解析后的响应（纯文本响应时为 nil）
+	Attempts   int                   // 实际尝试次数
+
+	Undelivered []string // 部分送达时未送达的链接（为空表示全部未送达），发件箱只重试这些链接
+}
+
+// OK 是否提交成功（已添加或已存在）
+func (r *SubmitResult) OK() bool {
+	return r.Status == SubmitAdded || r.Status == SubmitExists
+}
+
+// Retryable 是否为暂时性失败（网络错误、超时或 5xx），可稍后重试
+func (r *SubmitResult) Retryable() bool {
+	return r.Status == SubmitFailed && r.Attempts > 0
+}
+
+// Tested 是否为检测模式响应
+func (r *SubmitResult) Tested() bool {
+	return r.Response != nil && r.Response.TestedNodes != nil
+}
+
+// Added 检测模式下实际添加的节点数（非检测模式返回 -1）
+func (r *SubmitResult) Added() int {
+	if r.Response == nil || r.Response.AddedNodes == nil {
+		return -1
+	}
+	return *r.Response.AddedNodes
+}
+
+// ErrorText 响应中的错误信息，没有时使用 fallback
+func (r *SubmitResult) ErrorText(fallback string) string {
+	if r.Response != nil {
+		if r.Response.Error != "" {
+			return r.Response.Error
+		}
+		if r.Response.Message != "" {
+			return r.Response.Message
+		}
+	}
+	return fallback
+}
+
+// Summary 检测统计摘要（用于日志）
+func (r *SubmitResult) Summary() string {
+	if !r.Tested() {
+		return fmt.Sprintf("status=%d", r.StatusCode)
+	}
+	resp := r.Response
+	value := func(n *int) string {
+		if n == nil {
+			return "-"
+		}
+		return fmt.Sprint(*n)
+	}
+	return fmt.Sprintf("tested=%d, passed=%s, failed=%s, added=%s, duration=%s",
+		*resp.TestedNodes, value(resp.PassedNodes), value(resp.FailedNodes), value(resp.AddedNodes), resp.Duration)
+}
+
+// StatsText 检测统计信息（用于 Bot 回复），非检测模式返回空字符串
+func (r *SubmitResult) StatsText() string {
+	if !r.Tested() {
+		return ""
+	}
+	resp := r.Response
+	msg := fmt.Sprintf("📊 检测: %d个节点\n", *resp.TestedNodes)
+	if resp.PassedNodes != nil {
+		msg += fmt.Sprintf("✅ 通过: %d个\n", *resp.PassedNodes)
+	}
+	if resp.FailedNodes != nil {
+		msg += fmt.Sprintf("❌ 失败: %d个\n", *resp.FailedNodes)
+	}
+	if resp.AddedNodes != nil {
+		msg += fmt.Sprintf("➕ 添加: %d个\n", *resp.AddedNodes)
+	}
+	if resp.Duration != "" {
+		msg += fmt.Sprintf("⏱ 耗时: %s", resp.Duration)
+	}
+	if resp.Timeout != nil && *resp.Timeout && resp.Warning != "" {
+		msg += "\n⚠️ " + resp.Warning
+	}
+	return msg
+}
+
+// SubscriptionClient 订阅 API 客户端
+type SubscriptionClient struct {
+	addURL      string
+	apiKey      string
+	httpClient  *http.Client
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewSubscriptionClient 创建订阅 API 客户端
+func NewSubscriptionClient(addURL string, apiKey string) *SubscriptionClient {
+	return &SubscriptionClient{
+		addURL:      addURL,
+		apiKey:      apiKey,
+		httpClient:  &http.Client{Timeout: subscriptionAPITimeout},
+		maxAttempts: subscriptionAPIMaxAttempts,
+		backoff:     subscriptionAPIBackoff,
+	}
+}
+
+// Enabled 是否配置了 API 地址
+func (c *SubscriptionClient) Enabled() bool {
+	return c != nil && c.addURL != ""
+}
+
+// SubmitLink 提交单个订阅链接或节点
+func (c *SubscriptionClient) SubmitLink(ctx context.Context, link string, isNode bool) (*SubmitResult, error) {
+	req := SubscriptionRequest{Test: true}
+	if isNode {
+		req.SS = link
+	} else {
+		req.SubURL = link
+	}
+	return c.Submit(ctx, req)
+}
+
+// SubmitNodes 批量提交节点（多个节点用换行连接）
+func (c *SubscriptionClient) SubmitNodes(ctx context.Context, nodes []string) (*SubmitResult, error) {
+	return c.Submit(ctx, SubscriptionRequest{SS: strings.Join(nodes, "\n"), Test: true})
+}
+
+// Submit 提交请求，5xx 和网络错误（超时、连接被拒绝或重置）按指数退避重试；409 视为成功（SubmitExists）
+// 返回的 error 非空时 result 仍可能携带 API 响应（例如 400 检测失败的统计信息）
+func (c *SubscriptionClient) Submit(ctx context.Context, reqBody SubscriptionRequest) (*SubmitResult, error) {
+	result := &SubmitResult{Status: SubmitFailed}
+	if !c.Enabled() {
+		return result, fmt.Errorf("订阅 API 未配置")
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return result, fmt.Errorf("JSON 序列化失败: %w", err)
+	}
+
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		result.Attempts = attempt
+		retry, err := c.do(ctx, jsonData, result)
+		if err == nil || !retry || attempt >= c.maxAttempts {
+			return result, err
+		}
+
+		fmt.Printf("⚠️  订阅 API 请求失败，%v 后重试 (%d/%d): %v\n", backoff, attempt, c.maxAttempts, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// do 发送一次请求并填充 result，返回 (是否可重试, error)
+func (c *SubscriptionClient) do(ctx context.Context, jsonData []byte, result *SubmitResult) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.addURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return false, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("X-API-Key", c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return isTransportError(err) && ctx.Err() == nil, fmt.Errorf("API 请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	// fmt.Printf("[DEBUG] 订阅 API 响应 (status=%d, body=%s)\n", resp.StatusCode, string(body))
+
+	result.StatusCode = resp.StatusCode
+	result.Response = nil
+	var response SubscriptionResponse
+	if err := json.Unmarshal(body, &response); err == nil {
+		result.Response = &response
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		// 200 视为成功（包括无法解析为 JSON 的纯文本响应）
+		result.Status = SubmitAdded
+		return false, nil
+	case resp.StatusCode == http.StatusConflict:
+		result.Status = SubmitExists
+		return false, nil
+	case resp.StatusCode >= 500:
+		result.Status = SubmitFailed
+		return true, fmt.Errorf("服务器错误: %s", result.ErrorText(fmt.Sprintf("状态码 %d", resp.StatusCode)))
+	default:
+		result.Status = SubmitRejected
+		return false, fmt.Errorf("%s", result.ErrorText(fmt.Sprintf("请求被拒绝 (状态码: %d)", resp.StatusCode)))
+	}
+}
+
+// isTransportError 是否为可重试的网络错误：超时、连接被拒绝或重置、连接被提前关闭
+// （API 重启期间常见）；URL 错误等请求本身的问题不重试
+func isTransportError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
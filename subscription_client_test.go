@@ -0,0 +1,98 @@
+// tdl-msgproce - 订阅 API 客户端测试
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestSubscriptionClient 创建不等待退避的客户端
+func newTestSubscriptionClient(url string) *SubscriptionClient {
+	c := NewSubscriptionClient(url, "key")
+	c.backoff = time.Millisecond
+	return c
+}
+
+func TestSubscriptionClientStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int // 依次返回的状态码，最后一个重复使用
+		status   SubmitStatus
+		attempts int
+		wantErr  bool
+	}{
+		{"200 添加", []int{http.StatusOK}, SubmitAdded, 1, false},
+		{"409 已存在视为成功", []int{http.StatusConflict}, SubmitExists, 1, false},
+		{"4xx 不重试", []int{http.StatusBadRequest}, SubmitRejected, 1, true},
+		{"5xx 重试后成功", []int{http.StatusBadGateway, http.StatusOK}, SubmitAdded, 2, false},
+		{"5xx 重试耗尽", []int{http.StatusServiceUnavailable}, SubmitFailed, subscriptionAPIMaxAttempts, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-API-Key") != "key" {
+					t.Errorf("X-API-Key = %q", r.Header.Get("X-API-Key"))
+				}
+				n := int(atomic.AddInt32(&calls, 1))
+				w.WriteHeader(tt.codes[min(n, len(tt.codes))-1])
+				w.Write([]byte(`{"message":"ok"}`))
+			}))
+			defer srv.Close()
+
+			result, err := newTestSubscriptionClient(srv.URL).SubmitLink(context.Background(), "https://a.com/sub", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.Status != tt.status || result.Attempts != tt.attempts || int(calls) != tt.attempts {
+				t.Errorf("Status=%d Attempts=%d calls=%d, want %d %d", result.Status, result.Attempts, calls, tt.status, tt.attempts)
+			}
+			if result.Retryable() != (tt.status == SubmitFailed) {
+				t.Errorf("Retryable = %v", result.Retryable())
+			}
+		})
+	}
+}
+
+func TestSubscriptionClientConnectionErrors(t *testing.T) {
+	// 连接被拒绝（API 重启中）应重试
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	result, err := newTestSubscriptionClient("http://"+addr).SubmitNodes(context.Background(), []string{"trojan://pw@a.com:443"})
+	if err == nil || result.Attempts != subscriptionAPIMaxAttempts || !result.Retryable() {
+		t.Errorf("连接被拒绝: Attempts=%d err=%v, want %d 次重试", result.Attempts, err, subscriptionAPIMaxAttempts)
+	}
+
+	// 连接被服务端直接关闭后，下一次请求成功
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	result, err = newTestSubscriptionClient(srv.URL).SubmitLink(context.Background(), "https://a.com/sub", false)
+	if err != nil || result.Status != SubmitAdded || result.Attempts != 2 {
+		t.Errorf("连接重置: Status=%d Attempts=%d err=%v, want 第 2 次成功", result.Status, result.Attempts, err)
+	}
+
+	// URL 本身无效时不重试
+	result, err = newTestSubscriptionClient("ftp://a.com/add").SubmitLink(context.Background(), "https://a.com/sub", false)
+	if err == nil || result.Attempts != 1 {
+		t.Errorf("无效 URL: Attempts=%d err=%v, want 不重试", result.Attempts, err)
+	}
+}
@@ -0,0 +1,291 @@
+// tdl-msgproce - 订阅流量与到期记录（Subscription-Userinfo）
+//
+// 日志输出规范：
+// - 使用 fmt.Printf() 输出用户可见的日志信息
+// - 调试日志使用 // fmt.Printf() 注释格式
+// - 不使用 zap 日志库
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSubRecheckInterval = 24 * time.Hour      // 已失效订阅的默认复查间隔（流量可能按月重置）
+	subRegistryMaxAge         = 30 * 24 * time.Hour // 超过该时间未再出现的订阅记录会被清理
+)
+
+// 订阅失效原因
+const (
+	subDeadExpired = "已过期"
+	subDeadTraffic = "流量耗尽"
+)
+
+// SubUserInfo Subscription-Userinfo 响应头：upload=..; download=..; total=..; expire=..
+type SubUserInfo struct {
+	Upload   int64 `json:"upload"`
+	Download int64 `json:"download"`
+	Total    int64 `json:"total"`  // 总流量（字节，0 表示不限）
+	Expire   int64 `json:"expire"` // 到期时间（Unix 秒，0 表示不过期）
+}
+
+// parseSubUserInfo 解析 Subscription-Userinfo 响应头，不存在或无法识别时返回 nil
+func parseSubUserInfo(header http.Header) *SubUserInfo {
+	value := header.Get("Subscription-Userinfo")
+	if value == "" {
+		return nil
+	}
+
+	info := &SubUserInfo{}
+	found := false
+	for _, part := range strings.Split(value, ";") {
+		key, raw, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		// 部分面板输出浮点数或科学计数法
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			continue
+		}
+		n := int64(f)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "upload":
+			info.Upload = n
+		case "download":
+			info.Download = n
+		case "total":
+			info.Total = n
+		case "expire":
+			info.Expire = n
+		default:
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	return info
+}
+
+// DeadReason 返回订阅失效原因（已过期或流量耗尽），仍可用时返回空字符串
+func (i *SubUserInfo) DeadReason(now time.Time) string {
+	if i.Expire > 0 && i.Expire <= now.Unix() {
+		return subDeadExpired
+	}
+	if i.Total > 0 && i.Upload+i.Download >= i.Total {
+		return subDeadTraffic
+	}
+	return ""
+}
+
+// String 流量与到期摘要
+func (i *SubUserInfo) String() string {
+	used := formatBytes(i.Upload + i.Download)
+	total := "不限"
+	if i.Total > 0 {
+		total = formatBytes(i.Total)
+	}
+	expire := "长期"
+	if i.Expire > 0 {
+		expire = time.Unix(i.Expire, 0).Format("2006-01-02")
+	}
+	return fmt.Sprintf("已用 %s / %s, 到期 %s", used, total, expire)
+}
+
+// formatBytes 将字节数格式化为可读文本
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.2f %s", f, units[i])
+}
+
+// SubscriptionRecord 单个订阅的记录
+type SubscriptionRecord struct {
+	UserInfo  *SubUserInfo `json:"userinfo,omitempty"`
+	Format    string       `json:"format,omitempty"` // 最近一次识别的内容格式
+	Nodes     int          `json:"nodes,omitempty"`  // 最近一次识别的节点数
+	CheckedAt int64        `json:"checked_at"`       // 最近一次下载时间（Unix 秒）
+	SeenAt    int64        `json:"seen_at"`          // 最近一次在消息、Bot 或代理中出现的时间
+}
+
+// DeadReason 订阅失效原因
+func (r *SubscriptionRecord) DeadReason(now time.Time) string {
+	if r.UserInfo == nil {
+		return ""
+	}
+	return r.UserInfo.DeadReason(now)
+}
+
+// SubscriptionRegistry 记录监听、Bot 和代理服务处理过的订阅的流量与到期信息（持久化到 DataDir）
+type SubscriptionRegistry struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]*SubscriptionRecord // 订阅链接 -> 记录
+	dirty   bool                           // 是否有未保存的修改（由 StartAutoSave 定期写入）
+}
+
+// NewSubscriptionRegistry 创建订阅记录
+func NewSubscriptionRegistry(path string) *SubscriptionRegistry {
+	return &SubscriptionRegistry{path: path, records: make(map[string]*SubscriptionRecord)}
+}
+
+// Load 从磁盘加载记录，返回记录数
+func (r *SubscriptionRegistry) Load() (int, error) {
+	var records map[string]*SubscriptionRecord
+	found, err := loadJSONFile(r.path, &records)
+	if err != nil || !found || records == nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = records
+	return len(r.records), nil
+}
+
+// Save 清理长期未出现的记录后写入磁盘（没有修改时跳过）
+func (r *SubscriptionRegistry) Save() error {
+	r.mu.Lock()
+	if !r.dirty {
+		r.mu.Unlock()
+		return nil
+	}
+	cutoff := time.Now().Add(-subRegistryMaxAge).Unix()
+	records := make(map[string]SubscriptionRecord, len(r.records))
+	for link, record := range r.records {
+		if record.SeenAt < cutoff {
+			delete(r.records, link)
+			continue
+		}
+		records[link] = *record
+	}
+	r.dirty = false
+	r.mu.Unlock()
+
+	if err := saveJSONFile(r.path, records); err != nil {
+		r.mu.Lock()
+		r.dirty = true
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// StartAutoSave 定期将订阅记录写入磁盘，ctx 结束时执行最后一次保存
+func (r *SubscriptionRegistry) StartAutoSave(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := r.Save(); err != nil {
+				fmt.Printf("⚠️  保存订阅记录失败: %v\n", err)
+			}
+			return
+		case <-ticker.C:
+			if err := r.Save(); err != nil {
+				fmt.Printf("⚠️  保存订阅记录失败: %v\n", err)
+			}
+		}
+	}
+}
+
+// Get 返回订阅记录的副本
+func (r *SubscriptionRegistry) Get(link string) (SubscriptionRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[link]
+	if !ok {
+		return SubscriptionRecord{}, false
+	}
+	return *record, true
+}
+
+// Record 记录一次下载结果（userinfo 为 nil 时保留已有的流量信息），返回失效原因
+func (r *SubscriptionRegistry) Record(link string, userInfo *SubUserInfo, format string, nodes int) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	record, ok := r.records[link]
+	if !ok {
+		record = &SubscriptionRecord{}
+		r.records[link] = record
+	}
+	if userInfo != nil {
+		record.UserInfo = userInfo
+	}
+	if format != "" {
+		record.Format = format
+		record.Nodes = nodes
+	}
+	record.CheckedAt = now.Unix()
+	record.SeenAt = now.Unix()
+	r.dirty = true
+	return record.DeadReason(now)
+}
+
+// KnownDead 订阅在复查间隔内被确认失效时返回失效原因和记录
+func (r *SubscriptionRegistry) KnownDead(link string, recheck time.Duration) (string, *SubUserInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[link]
+	if !ok {
+		return "", nil
+	}
+	now := time.Now()
+	record.SeenAt = now.Unix()
+	r.dirty = true
+
+	reason := record.DeadReason(now)
+	// 已过期的订阅不会恢复；流量耗尽的订阅可能在下个周期重置，超过复查间隔后重新下载
+	if reason == "" || (reason == subDeadTraffic && now.Sub(time.Unix(record.CheckedAt, 0)) >= recheck) {
+		return "", nil
+	}
+	info := *record.UserInfo
+	return reason, &info
+}
+
+// formatStatus 订阅记录统计文本（用于 /status）
+func (r *SubscriptionRegistry) formatStatus() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.records) == 0 {
+		return ""
+	}
+	now := time.Now()
+	withInfo, expired, exhausted := 0, 0, 0
+	for _, record := range r.records {
+		if record.UserInfo != nil {
+			withInfo++
+		}
+		switch record.DeadReason(now) {
+		case subDeadExpired:
+			expired++
+		case subDeadTraffic:
+			exhausted++
+		}
+	}
+	return fmt.Sprintf("\n🧾 订阅记录: %d (含流量信息 %d, 已过期 %d, 流量耗尽 %d)", len(r.records), withInfo, expired, exhausted)
+}
@@ -0,0 +1,41 @@
+// tdl-msgproce - 订阅流量记录测试
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionRegistrySave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	r := NewSubscriptionRegistry(path)
+
+	// Record 位于代理热路径上，只标记修改，不直接写盘
+	expired := &SubUserInfo{Total: 100, Expire: time.Now().Add(-time.Hour).Unix()}
+	if reason := r.Record("https://a.com/sub", expired, subFormatBase64, 3); reason != subDeadExpired {
+		t.Fatalf("Record = %q, want %q", reason, subDeadExpired)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Record 后文件已写入: %v", err)
+	}
+
+	// 长期未出现的记录在保存时清理
+	r.records["https://old.com/sub"] = &SubscriptionRecord{SeenAt: time.Now().Add(-subRegistryMaxAge - time.Hour).Unix()}
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded := NewSubscriptionRegistry(path)
+	if n, err := loaded.Load(); err != nil || n != 1 {
+		t.Fatalf("Load = %d, %v; want 1", n, err)
+	}
+	if reason, _ := loaded.KnownDead("https://a.com/sub", time.Hour); reason != subDeadExpired {
+		t.Errorf("KnownDead = %q, want %q", reason, subDeadExpired)
+	}
+	// KnownDead 更新了 SeenAt，需要再次保存
+	if !loaded.dirty {
+		t.Errorf("KnownDead 后未标记修改")
+	}
+}